@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/credentials"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+	"golang.org/x/term"
+)
+
+func authCommand(programName string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usageString, programName)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "login":
+		return authLoginCommand(programName, args[1:])
+	case "status":
+		return authStatusCommand(programName, args[1:])
+	case "logout":
+		return authLogoutCommand(programName, args[1:])
+	default:
+		return fmt.Errorf("unknown auth command %q, expected \"login\", \"status\" or \"logout\"", args[0])
+	}
+}
+
+// authLoginCommand checks the credentials against twitch and stores them,
+// together with the app token twitch issued for them.
+func authLoginCommand(programName string, args []string) error {
+	fs := newFlagSet("auth login", authLoginUsageString, programName)
+	clientId := fs.String("client-id", os.Getenv("TWITCH_CLIENT_ID"), "")
+	user := fs.Bool("user", false, "")
+	fs.Parse(args)
+
+	if *user {
+		return authLoginUser(*clientId)
+	}
+
+	// The secret is never taken from a flag, where it would end up in the
+	// shell history and be visible to other users in the process list.
+	clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
+	input := bufio.NewReader(os.Stdin)
+	var err error
+	if *clientId == "" {
+		if *clientId, err = prompt(input, "Client ID: "); err != nil {
+			return err
+		}
+	}
+	if clientSecret == "" {
+		if clientSecret, err = promptSecret(input, "Client secret: "); err != nil {
+			return err
+		}
+	}
+
+	twitchSvc, err := twitch.NewService(*clientId, clientSecret, authBaseURL, apiBaseURL)
+	if err != nil {
+		return fmt.Errorf("unable to log in: %v", err)
+	}
+
+	path := credentials.DefaultPath()
+	creds := credentials.Credentials{
+		ClientID:     *clientId,
+		ClientSecret: clientSecret,
+		AppToken:     twitchSvc.AppToken(),
+	}
+	// A user login stays valid as long as the client ID does not change.
+	if stored, err := credentials.Load(path); err == nil && stored.ClientID == *clientId {
+		creds.User, creds.UserToken = stored.User, stored.UserToken
+	}
+	err = credentials.Save(path, creds)
+	if err != nil {
+		return fmt.Errorf("unable to save credentials: %v", err)
+	}
+
+	fmt.Printf("Logged in. Credentials saved to %v.\n", path)
+	return nil
+}
+
+// authLoginUser logs in a twitch user with the device code flow and stores
+// the user token next to the stored credentials.
+func authLoginUser(clientId string) error {
+	path := credentials.DefaultPath()
+	stored, err := credentials.Load(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Public clients have no secret, so it is only used when one is known.
+	clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
+	if clientId == "" {
+		clientId = stored.ClientID
+	}
+	if clientId == "" {
+		if clientId, err = prompt(bufio.NewReader(os.Stdin), "Client ID: "); err != nil {
+			return err
+		}
+	}
+	if clientId != stored.ClientID {
+		stored = credentials.Credentials{ClientID: clientId, ClientSecret: clientSecret}
+	} else if clientSecret != "" {
+		stored.ClientSecret = clientSecret
+	}
+
+	auth, err := twitch.RequestDeviceAuthorization(authBaseURL, clientId, []string{twitch.ScopeUserReadFollows})
+	if err != nil {
+		return fmt.Errorf("unable to log in: %v", err)
+	}
+
+	fmt.Printf("To log in, open %v and enter the code %v.\n", auth.VerificationURI, auth.UserCode)
+	fmt.Println("Waiting for authorization...")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	token, err := twitch.PollDeviceToken(ctx, authBaseURL, clientId, stored.ClientSecret, auth)
+	if err != nil {
+		return fmt.Errorf("unable to log in: %v", err)
+	}
+
+	twitchSvc, err := twitch.NewService(clientId, stored.ClientSecret, authBaseURL, apiBaseURL,
+		twitch.WithUserToken(token, func(refreshed twitch.UserToken) { token = refreshed }),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to log in: %v", err)
+	}
+
+	twitchUser, err := twitchSvc.GetAuthenticatedUser()
+	if err != nil {
+		return fmt.Errorf("unable to log in: %v", err)
+	}
+
+	stored.User = &twitchUser
+	stored.UserToken = &token
+	if err := credentials.Save(path, stored); err != nil {
+		return fmt.Errorf("unable to save credentials: %v", err)
+	}
+
+	fmt.Printf("Logged in as %v. Credentials saved to %v.\n", twitchUser.DisplayName, path)
+	return nil
+}
+
+func authStatusCommand(programName string, args []string) error {
+	fs := newFlagSet("auth status", authStatusUsageString, programName)
+	fs.Parse(args)
+
+	path := credentials.DefaultPath()
+	creds, err := credentials.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("not logged in")
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in with client ID %v.\n", creds.ClientID)
+	fmt.Printf("Credentials file: %v\n", path)
+	if creds.AppToken.Valid() {
+		fmt.Printf("App token: valid until %v\n", creds.AppToken.ExpiresAt.Local().Format(time.DateTime))
+	} else {
+		fmt.Println("App token: none, a new one is requested on the next run")
+	}
+	if creds.User != nil && creds.UserToken != nil {
+		fmt.Printf("User: %v, with scopes %v\n", creds.User.Login, strings.Join(creds.UserToken.Scopes, " "))
+	} else {
+		fmt.Println("User: none, run \"auth login --user\" to use --followed")
+	}
+
+	if os.Getenv("TWITCH_CLIENT_ID") != "" || os.Getenv("TWITCH_CLIENT_SECRET") != "" {
+		fmt.Println("TWITCH_CLIENT_ID and TWITCH_CLIENT_SECRET are set and take precedence over the stored credentials.")
+	}
+	return nil
+}
+
+func authLogoutCommand(programName string, args []string) error {
+	fs := newFlagSet("auth logout", authLogoutUsageString, programName)
+	fs.Parse(args)
+
+	if err := credentials.Remove(credentials.DefaultPath()); err != nil {
+		return err
+	}
+
+	fmt.Println("Logged out.")
+	return nil
+}
+
+// prompt asks for a value on the terminal.
+func prompt(input *bufio.Reader, label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := input.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("unable to read %v: %v", strings.TrimSuffix(strings.ToLower(label), ": "), err)
+	}
+
+	value := strings.TrimSpace(line)
+	if value == "" {
+		return "", fmt.Errorf("%v cannot be empty", strings.TrimSuffix(strings.ToLower(label), ": "))
+	}
+	return value, nil
+}
+
+// promptSecret is like prompt, but does not echo what is typed when stdin is
+// a terminal.
+func promptSecret(input *bufio.Reader, label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return prompt(input, label)
+	}
+
+	fmt.Fprint(os.Stderr, label)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %v: %v", strings.TrimSuffix(strings.ToLower(label), ": "), err)
+	}
+
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", fmt.Errorf("%v cannot be empty", strings.TrimSuffix(strings.ToLower(label), ": "))
+	}
+	return value, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/downloader"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+func clipsCommand(programName string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usageString, programName)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		return clipsListCommand(programName, args[1:])
+	case "download":
+		return clipsDownloadCommand(programName, args[1:])
+	default:
+		return fmt.Errorf("unknown clips command %q, expected \"list\" or \"download\"", args[0])
+	}
+}
+
+// clipsListCommand prints the clips that match the arguments.
+func clipsListCommand(programName string, args []string) error {
+	fs := newFlagSet("clips list", clipsListUsageString, programName)
+	clipFlags := addClipFlags(fs)
+	formatFlag := fs.String("format", planFormatTable, "")
+	configFlags := addConfigFlags(fs)
+	fs.Parse(args)
+
+	// The format of the config file is the container of compilations.
+	cfg, err := configFlags.apply(fs, fs.Arg(0), "format")
+	if err != nil {
+		return err
+	}
+
+	query, err := clipFlags.query(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	format, err := parsePlanFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	svc, err := newClipService(twitch.QualityBest, cfg.Twitch, query.followed)
+	if err != nil {
+		return err
+	}
+
+	clips, err := query.fetch(svc)
+	if err != nil {
+		return err
+	}
+
+	return newPlan(clips, false).write(os.Stdout, format)
+}
+
+// clipsDownloadCommand downloads the clips that match the arguments.
+func clipsDownloadCommand(programName string, args []string) error {
+	fs := newFlagSet("clips download", clipsDownloadUsageString, programName)
+	clipFlags := addClipFlags(fs)
+	qualityFlag := fs.String("quality", "best", "")
+	outputDir := fs.String("output-dir", "out", "")
+	configFlags := addConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := configFlags.apply(fs, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	query, err := clipFlags.query(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	quality, err := twitch.ParseQuality(*qualityFlag)
+	if err != nil {
+		return err
+	}
+
+	svc, err := newClipService(quality, cfg.Twitch, query.followed)
+	if err != nil {
+		return err
+	}
+
+	clips, err := query.fetch(svc)
+	if err != nil {
+		return err
+	}
+
+	sources := svc.ClipSources(clips)
+	if len(sources) == 0 {
+		return query.noSources(clips)
+	}
+
+	// The position in the name keeps the clips in order when the directory
+	// is compiled later on.
+	downloads := pipeline.Downloads(sources)
+	for i := range downloads {
+		downloads[i].Name = fmt.Sprintf("%03d-%v", i+1, downloads[i].Name)
+	}
+
+	fmt.Println("Downloading clips...")
+
+	results, err := downloader.Stream(context.Background(), *outputDir, downloads)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("%v: %v\n", downloads[result.Index].Name, result.Err)
+			continue
+		}
+		fmt.Println(result.Path)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v clips could not be downloaded", failed, len(downloads))
+	}
+	return nil
+}
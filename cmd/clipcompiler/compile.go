@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+var videoExtensions = map[string]bool{".mp4": true, ".mov": true, ".mkv": true, ".webm": true}
+
+// compileCommand compiles video files that are already on disk.
+func compileCommand(programName string, args []string) error {
+	fs := newFlagSet("compile", compileUsageString, programName)
+	compilerFlags := addCompilerFlags(fs)
+	configFlags := addConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := configFlags.apply(fs, "")
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("no files provided")
+	}
+
+	paths, err := videoFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("no video files found")
+	}
+
+	options, err := compilerFlags.options(cfg.Presets)
+	if err != nil {
+		return err
+	}
+	// The files belong to the user, so they are never removed.
+	options = append(options, compiler.WithCleanup(false))
+
+	fmt.Println("Compiling files...")
+
+	report, err := compiler.New(options...).Run(paths)
+	return printReport(report, err, len(paths))
+}
+
+// videoFiles replaces the directories in paths by the video files they
+// contain, sorted by name.
+func videoFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && videoExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func configCommand(programName string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usageString, programName)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "validate":
+		return configValidateCommand(programName, args[1:])
+	default:
+		return fmt.Errorf("unknown config command %q, expected \"validate\"", args[0])
+	}
+}
+
+// configValidateCommand checks the config file without running anything.
+func configValidateCommand(programName string, args []string) error {
+	fs := newFlagSet("config validate", configValidateUsageString, programName)
+	configFlags := addConfigFlags(fs)
+	fs.Parse(args)
+
+	// A missing file is fine for the other commands, but not when it is
+	// the file being checked.
+	if _, err := loadConfig(*configFlags.path, true); err != nil {
+		return err
+	}
+
+	fmt.Printf("%v is valid.\n", *configFlags.path)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// digestCommand compiles the top clips of every followed channel into one
+// video, with a card introducing each channel.
+func digestCommand(programName string, args []string) error {
+	fs := newFlagSet("digest", digestUsageString, programName)
+	days := fs.Int("days", 1, "")
+	perChannel := fs.Int("per-channel", 3, "")
+	qualityFlag := fs.String("quality", "best", "")
+	compilerFlags := addCompilerFlags(fs)
+	cardDuration := fs.Float64("card-duration", compiler.DefaultSectionCards().Duration, "")
+	dryRun := fs.Bool("dry-run", false, "")
+	planFormatFlag := fs.String("plan-format", planFormatTable, "")
+	configFlags := addConfigFlags(fs)
+
+	// The default name is set on the value rather than the flag, so that the
+	// config file can still override it.
+	now := time.Now()
+	*compilerFlags.outputFileName = fmt.Sprintf("digest-%v.mp4", now.Format(time.DateOnly))
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return errors.New("digest takes no arguments")
+	}
+
+	cfg, err := configFlags.apply(fs, "digest")
+	if err != nil {
+		return err
+	}
+
+	// The limits are checked once the config file has filled in the flags.
+	if *days < 1 {
+		return errors.New("--days must be at least 1")
+	}
+	if *perChannel < 1 {
+		return errors.New("--per-channel must be at least 1")
+	}
+	if *cardDuration <= 0 {
+		return errors.New("--card-duration must be greater than 0")
+	}
+
+	var planFormat string
+	var options []compiler.Option
+	if *dryRun {
+		planFormat, err = parsePlanFormat(*planFormatFlag)
+	} else {
+		options, err = compilerFlags.options(cfg.Presets)
+	}
+	if err != nil {
+		return err
+	}
+
+	quality, err := twitch.ParseQuality(*qualityFlag)
+	if err != nil {
+		return err
+	}
+
+	svc, err := newClipService(quality, cfg.Twitch, true)
+	if err != nil {
+		return err
+	}
+
+	user, err := svc.GetAuthenticatedUser()
+	if err != nil {
+		return fmt.Errorf("error getting the logged in user: %v", err)
+	}
+
+	start := now.Add(-time.Duration(*days) * 24 * time.Hour)
+	clips, err := svc.GetFollowedDigest(user.ID, start, now, *perChannel)
+	if err != nil {
+		return fmt.Errorf("error fetching clips: %v", err)
+	}
+
+	if *dryRun {
+		return newPlan(clips, *compilerFlags.vertical != "").write(os.Stdout, planFormat)
+	}
+
+	// Every followed channel left in the digest has clips, so only their
+	// video files can be missing.
+	sources := svc.ClipSources(clips)
+	if len(sources) == 0 {
+		return errUnresolved(len(clips))
+	}
+
+	fmt.Println("Downloading clips...")
+
+	channels := map[string]string{}
+	for _, clip := range clips {
+		channels[clip.ID] = clip.BroadcasterName
+	}
+	sections := make([]string, len(sources))
+	for i, source := range sources {
+		sections[i] = channels[source.ClipID]
+	}
+
+	fmt.Println("Compiling clips as they are downloaded...")
+
+	cards := compiler.DefaultSectionCards()
+	cards.Duration = *cardDuration
+	clipCompiler := compiler.New(append(options, compiler.WithSectionCards(cards))...)
+	report, err := pipeline.RunSections(context.Background(), *compilerFlags.outputDir, sources, sections, clipCompiler)
+	return printReport(report, err, len(sources))
+}
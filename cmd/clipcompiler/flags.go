@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/config"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/credentials"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// clipService is the part of the twitch service used to find clips.
+type clipService interface {
+	GetBroadcasterID(username string) (string, error)
+	GetClips(broadcasterId, startDate, endDate string, count int) ([]twitch.Clip, error)
+	GetClipsBetween(broadcasterId string, start, end time.Time, count int) ([]twitch.Clip, error)
+	GetClipsByID(ids []string) ([]twitch.Clip, error)
+	GetAuthenticatedUser() (twitch.User, error)
+	GetFollowedClips(userId, startDate, endDate string, count int) ([]twitch.Clip, error)
+	GetFollowedDigest(userId string, start, end time.Time, perChannel int) ([]twitch.Clip, error)
+	ClipSources(clips []twitch.Clip) []twitch.ClipSource
+}
+
+// clipFlags select the clips of a command, together with its arguments.
+type clipFlags struct {
+	max         *int
+	clipList    *string
+	clipFile    *string
+	minViews    *int
+	minDuration *float64
+	maxDuration *float64
+	followed    *bool
+}
+
+func addClipFlags(fs *flag.FlagSet) clipFlags {
+	return clipFlags{
+		max:         fs.Int("max", 10, ""),
+		clipList:    fs.String("clips", "", ""),
+		clipFile:    fs.String("clips-file", "", ""),
+		minViews:    fs.Int("min-views", 0, ""),
+		minDuration: fs.Float64("min-duration", 0, ""),
+		maxDuration: fs.Float64("max-duration", 0, ""),
+		followed:    fs.Bool("followed", false, ""),
+	}
+}
+
+// clipQuery is the selection of clips made by the flags and arguments of a command.
+type clipQuery struct {
+	ids       []string
+	username  string
+	startDate string
+	endDate   string
+	max       int
+	filter    twitch.ClipFilter
+	// followed selects clips of every channel followed by the logged in user.
+	followed bool
+}
+
+// query checks the clip flags together with the username and dates in args.
+func (f clipFlags) query(args []string) (clipQuery, error) {
+	clipIDs, err := readClipIDs(*f.clipList, *f.clipFile)
+	if err != nil {
+		return clipQuery{}, err
+	}
+
+	filter := twitch.ClipFilter{
+		MinViews:    *f.minViews,
+		MinDuration: *f.minDuration,
+		MaxDuration: *f.maxDuration,
+	}
+
+	if *f.followed {
+		if len(clipIDs) > 0 {
+			return clipQuery{}, errors.New("--followed cannot be combined with --clips or --clips-file")
+		}
+		switch len(args) {
+		case 0:
+			return clipQuery{}, errors.New("no arguments provided")
+		case 1:
+			return clipQuery{}, errors.New("insufficient arguments provided")
+		case 2:
+			return clipQuery{startDate: args[0], endDate: args[1], max: *f.max, filter: filter, followed: true}, nil
+		default:
+			return clipQuery{}, errors.New("more than 2 arguments provided, --followed only takes the dates")
+		}
+	}
+
+	if len(clipIDs) > 0 {
+		if len(args) > 0 {
+			return clipQuery{}, errors.New("username and dates cannot be combined with --clips or --clips-file")
+		}
+		return clipQuery{ids: clipIDs, filter: filter}, nil
+	}
+
+	switch len(args) {
+	case 0:
+		return clipQuery{}, errors.New("no arguments provided")
+	case 1, 2:
+		return clipQuery{}, errors.New("insufficient arguments provided")
+	case 3:
+		return clipQuery{username: args[0], startDate: args[1], endDate: args[2], max: *f.max, filter: filter}, nil
+	default:
+		return clipQuery{}, errors.New("more than 3 arguments provided")
+	}
+}
+
+// fetch looks up the selected clips.
+func (q clipQuery) fetch(svc clipService) ([]twitch.Clip, error) {
+	if len(q.ids) > 0 {
+		clips, err := svc.GetClipsByID(q.ids)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching clips: %v", err)
+		}
+		return q.filter.Apply(clips), nil
+	}
+
+	if q.followed {
+		user, err := svc.GetAuthenticatedUser()
+		if err != nil {
+			return nil, fmt.Errorf("error getting the logged in user: %v", err)
+		}
+
+		clips, err := svc.GetFollowedClips(user.ID, q.startDate, q.endDate, q.max)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching clips: %v", err)
+		}
+		return q.filter.Apply(clips), nil
+	}
+
+	broadcasterId, err := svc.GetBroadcasterID(q.username)
+	if err != nil {
+		return nil, fmt.Errorf("error getting broadcaster id of %v: %v", q.username, err)
+	}
+
+	clips, err := svc.GetClips(broadcasterId, q.startDate, q.endDate, q.max)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching clips: %v", err)
+	}
+	return q.filter.Apply(clips), nil
+}
+
+// noSources explains why none of clips, as fetched by the query, can be
+// downloaded. Running out of clips after filtering is not an error, but
+// failing to find the video file of every clip is.
+func (q clipQuery) noSources(clips []twitch.Clip) error {
+	if len(clips) > 0 {
+		return errUnresolved(len(clips))
+	}
+	if len(q.ids) > 0 {
+		fmt.Println("None of the listed clips were found or passed the filters.")
+	} else {
+		fmt.Println("No clips within the specified date range passed the filters.")
+	}
+	return nil
+}
+
+// errUnresolved reports that the video file of none of count clips could be
+// found. ClipSources logs the reason for every clip.
+func errUnresolved(count int) error {
+	return fmt.Errorf("unable to find the video file of any of the %v clips", count)
+}
+
+// newClipService creates a twitch service with the credentials from the
+// environment, the config file or the credentials file, in that order. The
+// app token cached in the credentials file is reused while it is valid.
+// With user set, the service acts on behalf of the user logged in with
+// "auth login --user" instead.
+func newClipService(quality twitch.Quality, configCredentials config.Twitch, user bool) (clipService, error) {
+	stored, err := credentials.Load(credentials.DefaultPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	loggedIn := err == nil
+
+	if user {
+		return newUserClipService(quality, stored)
+	}
+
+	clientId, clientSecret := os.Getenv("TWITCH_CLIENT_ID"), os.Getenv("TWITCH_CLIENT_SECRET")
+	if clientId == "" && clientSecret == "" {
+		clientId, clientSecret = configCredentials.ClientID, configCredentials.ClientSecret
+	}
+	if clientId == "" && clientSecret == "" {
+		clientId, clientSecret = stored.ClientID, stored.ClientSecret
+	}
+
+	// Tokens are issued for a client ID, so the cached one only applies to the
+	// credentials it was issued for.
+	useCache := loggedIn && stored.ClientID == clientId
+	var cachedToken twitch.AppToken
+	if useCache {
+		cachedToken = stored.AppToken
+	}
+
+	twitchSvc, err := twitch.NewService(clientId, clientSecret, authBaseURL, apiBaseURL,
+		twitch.WithQuality(quality),
+		twitch.WithAppToken(cachedToken),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing twitch service: %v", err)
+	}
+
+	if token := twitchSvc.AppToken(); useCache && token.Value != stored.AppToken.Value {
+		stored.AppToken = token
+		if err := credentials.Save(credentials.DefaultPath(), stored); err != nil {
+			log.Printf("unable to cache app token: %v", err)
+		}
+	}
+
+	return twitchSvc, nil
+}
+
+// newUserClipService creates a twitch service with the stored user token.
+// The token was issued for the stored client ID, so the stored credentials
+// are used regardless of the environment. Refreshed tokens are stored again.
+func newUserClipService(quality twitch.Quality, stored credentials.Credentials) (clipService, error) {
+	if stored.UserToken == nil {
+		return nil, errors.New("followed channels require a user login, run \"auth login --user\" first")
+	}
+
+	saveToken := func(token twitch.UserToken) {
+		stored.UserToken = &token
+		if err := credentials.Save(credentials.DefaultPath(), stored); err != nil {
+			log.Printf("unable to store refreshed user token: %v", err)
+		}
+	}
+
+	twitchSvc, err := twitch.NewService(stored.ClientID, stored.ClientSecret, authBaseURL, apiBaseURL,
+		twitch.WithQuality(quality),
+		twitch.WithUserToken(*stored.UserToken, saveToken),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing twitch service: %v", err)
+	}
+
+	return twitchSvc, nil
+}
+
+// compilerFlags configure how clips are compiled.
+type compilerFlags struct {
+	outputDir       *string
+	outputFileName  *string
+	presetName      *string
+	presetsFile     *string
+	maxSize         *string
+	format          *string
+	previewGIF      *bool
+	previewWebP     *bool
+	thumbnail       *string
+	thumbnailFormat *string
+	thumbnailTitle  *string
+	vertical        *string
+	facecam         *string
+	transition      *string
+	transitionSecs  *float64
+	workers         *int
+	strict          *bool
+}
+
+func addCompilerFlags(fs *flag.FlagSet) compilerFlags {
+	return compilerFlags{
+		outputDir:       fs.String("output-dir", "out", ""),
+		outputFileName:  fs.String("output-file", "compilation.mp4", ""),
+		presetName:      fs.String("preset", compiler.DefaultPresetName, ""),
+		presetsFile:     fs.String("presets-file", compiler.DefaultPresetsPath(), ""),
+		maxSize:         fs.String("max-size", "", ""),
+		format:          fs.String("format", "", ""),
+		previewGIF:      fs.Bool("preview-gif", false, ""),
+		previewWebP:     fs.Bool("preview-webp", false, ""),
+		thumbnail:       fs.String("thumbnail", "", ""),
+		thumbnailFormat: fs.String("thumbnail-format", "png", ""),
+		thumbnailTitle:  fs.String("thumbnail-title", "", ""),
+		vertical:        fs.String("vertical", "", ""),
+		facecam:         fs.String("facecam", "", ""),
+		transition:      fs.String("transition", "", ""),
+		transitionSecs:  fs.Float64("transition-duration", compiler.DefaultTransitionDuration, ""),
+		workers:         fs.Int("workers", 0, ""),
+		strict:          fs.Bool("strict", false, ""),
+	}
+}
+
+// options turns the flags into compiler options. extraPresets are added to
+// those of the presets file.
+func (f compilerFlags) options(extraPresets map[string]compiler.Preset) ([]compiler.Option, error) {
+	presets, err := compiler.LoadPresets(*f.presetsFile)
+	if err != nil {
+		return nil, err
+	}
+	for name, preset := range extraPresets {
+		presets[name] = preset
+	}
+
+	preset, err := compiler.LookupPreset(presets, *f.presetName)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []compiler.Option{
+		compiler.WithOutputDir(*f.outputDir),
+		compiler.WithPreset(preset),
+	}
+
+	if *f.format != "" {
+		container, err := compiler.ParseContainer(*f.format)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, compiler.WithContainer(container))
+	}
+	options = append(options, compiler.WithOutputFileName(f.outputFile()))
+
+	switch {
+	case *f.previewGIF && *f.previewWebP:
+		return nil, errors.New("--preview-gif and --preview-webp cannot be used together")
+	case *f.previewGIF:
+		options = append(options, compiler.WithPreview(compiler.DefaultPreview(compiler.PreviewGIF)))
+	case *f.previewWebP:
+		options = append(options, compiler.WithPreview(compiler.DefaultPreview(compiler.PreviewWebP)))
+	}
+
+	if *f.strict {
+		options = append(options, compiler.WithStrict(true))
+	}
+
+	if *f.workers > 0 {
+		options = append(options, compiler.WithWorkers(*f.workers))
+	}
+
+	if *f.maxSize != "" {
+		maxSize, err := compiler.ParseByteSize(*f.maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max size: %v", err)
+		}
+		options = append(options, compiler.WithMaxSize(maxSize))
+	}
+
+	if *f.thumbnail != "" {
+		mode, err := compiler.ParseThumbnailMode(*f.thumbnail)
+		if err != nil {
+			return nil, err
+		}
+
+		format, err := compiler.ParseThumbnailFormat(*f.thumbnailFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, compiler.WithThumbnail(compiler.Thumbnail{
+			Mode:   mode,
+			Format: format,
+			Title:  *f.thumbnailTitle,
+		}))
+	}
+
+	if *f.vertical != "" {
+		mode, err := compiler.ParseVerticalMode(*f.vertical)
+		if err != nil {
+			return nil, err
+		}
+
+		vertical := compiler.Vertical{Mode: mode}
+		if *f.facecam != "" {
+			facecam, err := compiler.ParseRect(*f.facecam)
+			if err != nil {
+				return nil, fmt.Errorf("invalid facecam region: %v", err)
+			}
+			vertical.Facecam = &facecam
+		}
+		options = append(options, compiler.WithVertical(vertical))
+	} else if *f.facecam != "" {
+		return nil, errors.New("--facecam can only be used together with --vertical")
+	}
+
+	if *f.transition != "" {
+		transitionType, err := compiler.ParseTransitionType(*f.transition)
+		if err != nil {
+			return nil, err
+		}
+
+		transition := compiler.Transition{Type: transitionType, Duration: *f.transitionSecs}
+		if err := transition.Validate(); err != nil {
+			return nil, err
+		}
+		options = append(options, compiler.WithTransition(transition))
+	}
+
+	return options, nil
+}
+
+// outputFile returns the name of the final file, with the extension of the
+// chosen format.
+func (f compilerFlags) outputFile() string {
+	outputFileName := *f.outputFileName
+	if container, err := compiler.ParseContainer(*f.format); *f.format != "" && err == nil {
+		outputFileName = strings.TrimSuffix(outputFileName, filepath.Ext(outputFileName)) + "." + container
+	}
+	return outputFileName
+}
+
+// printReport lists the skipped clips of a compilation of total clips and
+// returns the error that the command should fail with, if any. In strict
+// mode the compiler itself fails as soon as any clip is skipped.
+func printReport(report compiler.Report, err error, total int) error {
+	for _, skipped := range report.Skipped {
+		fmt.Println(skipped)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Compiled %v of %v clips.\n", len(report.Included), total)
+	return nil
+}
+
+// configFlags select the config file and the recipe of a command.
+type configFlags struct {
+	path   *string
+	recipe *string
+}
+
+func addConfigFlags(fs *flag.FlagSet) configFlags {
+	return configFlags{
+		path:   fs.String("config", config.DefaultPath(), ""),
+		recipe: fs.String("recipe", "", ""),
+	}
+}
+
+// apply loads the config file and uses its settings for the flags that were
+// not given on the command line, except for the flags in skip. Unless another
+// recipe is chosen, the recipe named after username is applied over the top
+// level settings.
+func (f configFlags) apply(fs *flag.FlagSet, username string, skip ...string) (config.Config, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	cfg, err := loadConfig(*f.path, given["config"])
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	recipe := *f.recipe
+	if recipe == "" && cfg.HasRecipe(username) {
+		recipe = username
+	}
+
+	settings, err := cfg.Recipe(recipe)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	for name, value := range settings.Flags() {
+		if given[name] || fs.Lookup(name) == nil || slices.Contains(skip, name) {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return config.Config{}, fmt.Errorf("invalid value for %v in config file: %v", name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// loadConfig loads and validates the config file. A missing file is only an
+// error when its path was given explicitly.
+func loadConfig(path string, explicit bool) (config.Config, error) {
+	if path == "" {
+		return config.Config{}, nil
+	}
+
+	cfg, err := config.Load(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return config.Config{}, nil
+	} else if err != nil {
+		return config.Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, fmt.Errorf("invalid config file %v:\n%v", path, err)
+	}
+	return cfg, nil
+}
+
+// readClipIDs collects clip IDs from the comma separated list and the clip file,
+// preserving the order in which they were given.
+func readClipIDs(list, filePath string) ([]string, error) {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	if filePath != "" {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read clip file: %v", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read clip file: %v", err)
+		}
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id, err := twitch.ParseClipID(entry)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
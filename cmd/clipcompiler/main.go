@@ -1,104 +1,60 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
-	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
-	"github.com/jaaanko/twitch-clip-compilation-tool/internal/downloader"
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
 )
 
 const (
-	authBaseURL = "https://id.twitch.tv"
-	apiBaseURL  = "https://api.twitch.tv/helix"
-	usageString = `
-
-Usage: %v [options] username start_date end_date
-			 
-Arguments
-
-	username      :   Unique twitch username of the user you wish to watch clips from. [required]
-	start_date    :   Start date in YY-MM-DD format (example: 2023-04-26). [required]
-	end_date      :   End date in YY-MM-DD format (example: 2023-04-26). [required]
-Options
-
-	--max	      :   Maximum number of clips to fetch. Default is 10.
-	--output-dir  :   Name of the directory where the final .mp4 file and any temporary files will be placed. 
-	                  A default folder named "out" will be created in the current directory if not specified.
-	--output-file :   Name of the final .mp4 file. Default is "compilation.mp4".
-	--help        :   Displays this message and exits the program.
-
-`
+	authBaseURL = twitch.DefaultAuthBaseURL
+	apiBaseURL  = twitch.DefaultAPIBaseURL
 )
 
 func main() {
-	clientId := os.Getenv("TWITCH_CLIENT_ID")
-	clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
 	programName := filepath.Base(os.Args[0])
-	flag.Usage = func() {
+	args := os.Args[1:]
+	if len(args) == 0 {
 		fmt.Fprintf(os.Stderr, usageString, programName)
+		os.Exit(2)
 	}
 
-	max := flag.Int("max", 10, "")
-	outputDir := flag.String("output-dir", "out", "")
-	outputFileName := flag.String("output-file", "compilation.mp4", "")
-	flag.Parse()
-	args := flag.Args()
-	var username, start, end string
-
-	switch len(args) {
-	case 0:
-		log.Fatal("no arguments provided")
-	case 1, 2:
-		log.Fatal("insufficient arguments provided")
-	case 3:
-		username = args[0]
-		start = args[1]
-		end = args[2]
+	var err error
+	switch args[0] {
+	case "clips":
+		err = clipsCommand(programName, args[1:])
+	case "auth":
+		err = authCommand(programName, args[1:])
+	case "config":
+		err = configCommand(programName, args[1:])
+	case "compile":
+		err = compileCommand(programName, args[1:])
+	case "run":
+		err = runCommand(programName, args[1:])
+	case "digest":
+		err = digestCommand(programName, args[1:])
+	case "serve":
+		err = serveCommand(programName, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(os.Stderr, usageString, programName)
 	default:
-		log.Fatal("more than 3 arguments provided")
+		// Invocations from before commands existed are runs.
+		err = runCommand(programName, args)
 	}
 
-	twitchSvc, err := twitch.NewService(clientId, clientSecret, authBaseURL, apiBaseURL)
 	if err != nil {
-		log.Fatalf("error initializing twitch service: %v", err)
-	}
-
-	broadcasterId, err := twitchSvc.GetBroadcasterID(username)
-	if err != nil {
-		log.Fatalf("error getting broadcaster id of %v: %v", username, err)
-	}
-
-	fmt.Println("Downloading clips...")
-
-	urls, err := twitchSvc.GetClipURLs(broadcasterId, start, end, *max)
-	if err != nil {
-		log.Fatalf("error fetching clips: %v", err)
-	} else if len(urls) == 0 {
-		fmt.Println("No clips found within the specified date range.")
-		return
-	}
-
-	downloadedClips, err := downloader.Run(*outputDir, urls)
-	if errors.Is(err, downloader.ErrCreateOutputDir) {
 		log.Fatal(err)
-	} else if err != nil {
-		fmt.Println(err)
 	}
+}
 
-	fmt.Println("Compiling downloaded clips...")
-
-	compiler := compiler.New(
-		compiler.WithOutputDir(*outputDir),
-		compiler.WithOutputFileName(*outputFileName),
-	)
-
-	if err = compiler.Run(downloadedClips); err != nil {
-		log.Fatal(err)
+func newFlagSet(name, usage, programName string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, programName)
 	}
+	return fs
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+const (
+	planFormatTable = "table"
+	planFormatJSON  = "json"
+	// maxVerticalRuntime is the length vertical exports are cut to.
+	maxVerticalRuntime = 60 * time.Second
+)
+
+// plan is what a run would compile, as printed by --dry-run.
+type plan struct {
+	Clips []twitch.Clip `json:"clips"`
+	// EstimatedRuntime is the estimated length of the compilation in seconds.
+	EstimatedRuntime float64 `json:"estimated_runtime"`
+}
+
+func newPlan(clips []twitch.Clip, vertical bool) plan {
+	var runtime float64
+	for _, clip := range clips {
+		runtime += clip.Duration
+	}
+	if vertical {
+		runtime = min(runtime, maxVerticalRuntime.Seconds())
+	}
+
+	return plan{Clips: clips, EstimatedRuntime: runtime}
+}
+
+func parsePlanFormat(s string) (string, error) {
+	switch s {
+	case "", planFormatTable:
+		return planFormatTable, nil
+	case planFormatJSON:
+		return planFormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown dry run format %q, expected %q or %q", s, planFormatTable, planFormatJSON)
+	}
+}
+
+func (p plan) write(w io.Writer, format string) error {
+	if format == planFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTITLE\tCLIPPER\tVIEWS\tDURATION\tCREATED AT\tURL")
+	for i, clip := range p.Clips {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			i+1, clip.Title, clip.CreatorName, clip.ViewCount,
+			formatSeconds(clip.Duration), clip.CreatedAt.Format(time.DateTime), clip.URL,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%v clips, estimated runtime %v\n", len(p.Clips), formatSeconds(p.EstimatedRuntime))
+	return err
+}
+
+// formatSeconds formats a duration in seconds as m:ss.
+func formatSeconds(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
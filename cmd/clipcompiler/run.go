@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// runCommand fetches, downloads and compiles clips.
+func runCommand(programName string, args []string) error {
+	fs := newFlagSet("run", runUsageString, programName)
+	clipFlags := addClipFlags(fs)
+	qualityFlag := fs.String("quality", "best", "")
+	compilerFlags := addCompilerFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "")
+	planFormatFlag := fs.String("plan-format", planFormatTable, "")
+	configFlags := addConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := configFlags.apply(fs, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	query, err := clipFlags.query(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var planFormat string
+	var options []compiler.Option
+	if *dryRun {
+		planFormat, err = parsePlanFormat(*planFormatFlag)
+	} else {
+		options, err = compilerFlags.options(cfg.Presets)
+	}
+	if err != nil {
+		return err
+	}
+
+	quality, err := twitch.ParseQuality(*qualityFlag)
+	if err != nil {
+		return err
+	}
+
+	svc, err := newClipService(quality, cfg.Twitch, query.followed)
+	if err != nil {
+		return err
+	}
+
+	clips, err := query.fetch(svc)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		return newPlan(clips, *compilerFlags.vertical != "").write(os.Stdout, planFormat)
+	}
+
+	sources := svc.ClipSources(clips)
+	if len(sources) == 0 {
+		return query.noSources(clips)
+	}
+
+	fmt.Println("Downloading clips...")
+
+	fmt.Println("Compiling clips as they are downloaded...")
+
+	clipCompiler := compiler.New(options...)
+	report, err := pipeline.Run(context.Background(), *compilerFlags.outputDir, sources, clipCompiler)
+	return printReport(report, err, len(sources))
+}
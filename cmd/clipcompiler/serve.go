@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/config"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/schedule"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// serveCommand runs the jobs of a schedule file until it is interrupted.
+func serveCommand(programName string, args []string) error {
+	fs := newFlagSet("serve", serveUsageString, programName)
+	schedulePath := fs.String("schedule", "", "")
+	statePath := fs.String("state", schedule.DefaultStatePath(), "")
+	configPath := fs.String("config", config.DefaultPath(), "")
+	fs.Parse(args)
+
+	if *schedulePath == "" {
+		return errors.New("serve requires a schedule file, see --schedule")
+	}
+	if fs.NArg() > 0 {
+		return errors.New("serve takes no arguments")
+	}
+
+	configGiven := false
+	fs.Visit(func(f *flag.Flag) {
+		configGiven = configGiven || f.Name == "config"
+	})
+	cfg, err := loadConfig(*configPath, configGiven)
+	if err != nil {
+		return err
+	}
+
+	s, err := schedule.Load(*schedulePath)
+	if err != nil {
+		return err
+	}
+	if err := s.Validate(cfg); err != nil {
+		return fmt.Errorf("invalid schedule file %v:\n%v", *schedulePath, err)
+	}
+
+	scheduler, err := schedule.New(s, *statePath, scheduledRun(cfg))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("scheduled %v jobs from %v, state is kept in %v", len(s.Jobs), *schedulePath, *statePath)
+	return scheduler.Run(ctx)
+}
+
+// scheduledRun returns the runner of scheduled jobs. A job runs like the run
+// command with the job's settings as options.
+func scheduledRun(cfg config.Config) schedule.Runner {
+	return func(ctx context.Context, job schedule.Job, window schedule.Window) (string, error) {
+		settings, err := job.ResolveSettings(cfg)
+		if err != nil {
+			return "", err
+		}
+
+		fs := flag.NewFlagSet(job.Name, flag.ContinueOnError)
+		clipFlags := addClipFlags(fs)
+		qualityFlag := fs.String("quality", "best", "")
+		compilerFlags := addCompilerFlags(fs)
+		for name, value := range settings.Flags() {
+			if fs.Lookup(name) == nil {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return "", fmt.Errorf("invalid value for %v: %v", name, err)
+			}
+		}
+		// Every run gets a file of its own unless the job names one.
+		if settings.OutputFile == "" {
+			*compilerFlags.outputFileName = job.DefaultOutputFile(window)
+		}
+
+		query, err := clipFlags.query([]string{job.Streamer, window.Start.Format(time.DateOnly), window.End.Format(time.DateOnly)})
+		if err != nil {
+			return "", err
+		}
+
+		options, err := compilerFlags.options(cfg.Presets)
+		if err != nil {
+			return "", err
+		}
+
+		quality, err := twitch.ParseQuality(*qualityFlag)
+		if err != nil {
+			return "", err
+		}
+
+		svc, err := newClipService(quality, cfg.Twitch, false)
+		if err != nil {
+			return "", err
+		}
+
+		broadcasterId, err := svc.GetBroadcasterID(job.Streamer)
+		if err != nil {
+			return "", fmt.Errorf("error getting broadcaster id of %v: %v", job.Streamer, err)
+		}
+
+		// The API includes clips created at ended_at, which belongs to the next window.
+		clips, err := svc.GetClipsBetween(broadcasterId, window.Start, window.End.Add(-time.Second), query.max)
+		if errors.Is(err, twitch.ErrNoClips) {
+			log.Printf("job %v: %v", job.Name, err)
+			return "", nil
+		} else if err != nil {
+			return "", fmt.Errorf("error fetching clips: %v", err)
+		}
+
+		sources := svc.ClipSources(query.filter.Apply(clips))
+		if len(sources) == 0 {
+			log.Printf("job %v: no clips left after filtering", job.Name)
+			return "", nil
+		}
+
+		report, err := pipeline.Run(ctx, *compilerFlags.outputDir, sources, compiler.New(options...))
+		if err := printReport(report, err, len(sources)); err != nil {
+			return "", err
+		}
+
+		return filepath.Join(*compilerFlags.outputDir, compilerFlags.outputFile()), nil
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+const (
+	usageString = `
+
+Usage: %[1]v <command> [options] [arguments]
+
+Commands
+
+	clips list    :   Print the clips that match the arguments without downloading them.
+	clips download:   Download clips into the output directory without compiling them.
+	compile       :   Compile video files that are already on disk.
+	run           :   Fetch, download and compile clips. Running %[1]v without a command
+	                  is the same as running "%[1]v run".
+	digest        :   Compile the top clips of every channel you follow, with a card
+	                  introducing each channel.
+	serve --schedule:
+	                  Run the jobs of a schedule file whenever they are due, each compiling
+	                  the clips created since its previous run.
+	auth login    :   Store your twitch credentials, so that they do not have to be exported
+	                  in every shell.
+	auth login --user:
+	                  Log in as a twitch user to compile clips of the channels you follow.
+	auth status   :   Show the stored credentials.
+	auth logout   :   Remove the stored credentials.
+	config validate:
+	                  Check the config file for mistakes.
+
+Run "%[1]v <command> --help" to see the arguments and options of a command.
+
+`
+
+	clipsArgumentsUsage = `
+Arguments
+
+	username      :   Unique twitch username of the user you wish to watch clips from. [required]
+	start_date    :   Start date in YY-MM-DD format (example: 2023-04-26). [required]
+	end_date      :   End date in YY-MM-DD format (example: 2023-04-26). [required]`
+
+	clipsOptionsUsage = `
+	--max	      :   Maximum number of clips to fetch. Default is 10.
+	--clips       :   Comma separated list of clip URLs or IDs to use in the given order.
+	                  The username and date arguments are not used in this mode.
+	--clips-file  :   Path to a file containing one clip URL or ID per line. Blank lines and
+	                  lines starting with # are ignored. Can be combined with --clips.
+	--min-views   :   Leave out clips with fewer views.
+	--min-duration:   Leave out clips shorter than this many seconds.
+	--max-duration:   Leave out clips longer than this many seconds.
+	--followed    :   Use the most viewed clips across every channel you follow. Takes only the
+	                  start_date and end_date arguments and requires "auth login --user".`
+
+	qualityOptionUsage = `
+	--quality     :   Rendition of each clip to download: "best", "worst" or a video height
+	                  such as 720. Default is "best".`
+
+	compilerOptionsUsage = `
+	--output-dir  :   Name of the directory where the final file will be placed. A default
+	                  folder named "out" will be created in the current directory if not specified.
+	--output-file :   Name of the final file. Default is "compilation.mp4". The container is chosen
+	                  from the extension: .mp4, .mov, .mkv or .webm (VP9/Opus).
+	--format      :   Container of the final file (mp4, mov, mkv or webm). Replaces the extension
+	                  of the output file.
+	--preview-gif :   Also write a short, low resolution animated GIF preview of the compilation.
+	--preview-webp:   Also write a short, low resolution animated WebP preview of the compilation.
+	--preset      :   Name of the output preset used to encode the final file. Builtin presets are
+	                  archive-copy (default), youtube-1080p, twitter-720p and discord-8mb.
+	--presets-file:   YAML file with additional presets. Defaults to clipcompiler/presets.yaml
+	                  inside the user config directory.
+	--thumbnail   :   Also write a thumbnail next to the final file. "top" uses a frame of the most
+	                  viewed clip, "first" a frame of the first clip and "sheet" arranges one frame
+	                  per clip in a grid.
+	--thumbnail-format:
+	                  Image format of the thumbnail, "png" (default) or "jpg".
+	--thumbnail-title:
+	                  Title rendered on the thumbnail.
+	--max-size    :   Largest allowed size of the final file (example: 25MB). The compilation is
+	                  re-encoded in two passes to land under the limit.
+	--vertical    :   Export a 1080x1920 video for short-form platforms, limited to 60 seconds.
+	                  "blur" fills the frame with a blurred copy of the clip, "crop" crops the sides.
+	--facecam     :   Region of the source video to stack on top of a vertical export, in
+	                  width:height:x:y format (example: 480:270:1440:810).
+	--transition  :   Blend every clip into the next one with an ffmpeg xfade transition, such
+	                  as "fade", "dissolve" or "wipeleft". The audio is crossfaded. The
+	                  compilation is always re-encoded.
+	--transition-duration:
+	                  Length of each transition in seconds. Default is 0.5.
+	--workers     :   Number of clips processed with ffmpeg at the same time. Defaults to the
+	                  number of CPUs.
+	--strict      :   Fail if any clip cannot be downloaded or processed. By default such clips
+	                  are left out of the compilation.`
+
+	configOptionsUsage = `
+	--config      :   Config file to read, in YAML or, with a .toml extension, TOML format.
+	                  Defaults to clipcompiler/config.yaml inside the user config directory, or
+	                  config.toml if only that exists. Options given on the command line take precedence over
+	                  the environment, which takes precedence over the config file.
+	--recipe      :   Recipe of the config file to use. Defaults to the recipe named after the
+	                  username, if there is one.`
+
+	helpOptionUsage = `
+	--help        :   Displays this message and exits the program.
+
+`
+
+	runUsageString = `
+
+Usage: %[1]v run [options] username start_date end_date
+       %[1]v run [options] --clips=url1,url2,...
+       %[1]v run [options] --clips-file=path
+       %[1]v run [options] --followed start_date end_date
+` + clipsArgumentsUsage + `
+
+Options
+` + clipsOptionsUsage + qualityOptionUsage + compilerOptionsUsage + `
+	--dry-run     :   Print the clips that would be compiled and the estimated runtime without
+	                  downloading anything.
+	--plan-format :   Output of --dry-run, "table" (default) or "json".` +
+		configOptionsUsage + helpOptionUsage
+
+	clipsListUsageString = `
+
+Usage: %[1]v clips list [options] username start_date end_date
+       %[1]v clips list [options] --clips=url1,url2,...
+       %[1]v clips list [options] --clips-file=path
+       %[1]v clips list [options] --followed start_date end_date
+` + clipsArgumentsUsage + `
+
+Options
+` + clipsOptionsUsage + `
+	--format      :   "table" (default) or "json".` + configOptionsUsage + helpOptionUsage
+
+	clipsDownloadUsageString = `
+
+Usage: %[1]v clips download [options] username start_date end_date
+       %[1]v clips download [options] --clips=url1,url2,...
+       %[1]v clips download [options] --clips-file=path
+       %[1]v clips download [options] --followed start_date end_date
+` + clipsArgumentsUsage + `
+
+Options
+` + clipsOptionsUsage + qualityOptionUsage + `
+	--output-dir  :   Directory the clips are downloaded to. Default is "out". Files are named
+	                  after their position and clip ID, so that "%[1]v compile" keeps their order.` +
+		configOptionsUsage + helpOptionUsage
+
+	digestUsageString = `
+
+Usage: %[1]v digest [options]
+
+Compiles the most viewed clips of every channel you follow into one video, with a card
+introducing each channel. Channels are ordered by their most viewed clip. The final file
+is named digest-<date>.mp4 unless --output-file is given. Requires "auth login --user".
+
+Options
+
+	--days        :   Number of days to take clips from, counted back from now. Default is 1.
+	--per-channel :   Maximum number of clips of each channel. Default is 3.` + qualityOptionUsage + `
+	--card-duration:
+	                  Length of each channel card in seconds. Default is 3. Cards are always
+	                  re-encoded together with the clips, even with the archive-copy preset.` +
+		compilerOptionsUsage + `
+	--dry-run     :   Print the clips that would be compiled and the estimated runtime without
+	                  downloading anything.
+	--plan-format :   Output of --dry-run, "table" (default) or "json".` +
+		configOptionsUsage + `
+	                  The recipe named "digest" is used by default.` + helpOptionUsage
+
+	serveUsageString = `
+
+Usage: %[1]v serve [options] --schedule=path
+
+Runs the jobs of a schedule file until interrupted. Each job compiles the clips of a streamer
+created since its previous run whenever its cron expression matches, so that consecutive
+compilations never cover the same clips. Runs that were missed while %[1]v was not running
+are made up for with a single run once it starts again. A job that is running when %[1]v
+is interrupted is stopped and runs again once it starts.
+
+Options
+
+	--schedule    :   YAML file with the jobs to run. [required] Every job has a streamer, a
+	                  cron expression (example: "0 6 * * 1" for Mondays at 6:00) and any setting
+	                  of the config file, such as preset, output_dir or filters. Jobs are named
+	                  after their streamer unless they have a name.
+	--state       :   File that keeps track of the last run of every job. Defaults to
+	                  clipcompiler/schedule-state.json inside the user config directory.
+	--config      :   Config file to read. Defaults to clipcompiler/config.yaml inside the user
+	                  config directory. Job settings are applied over the recipe of the job,
+	                  or the recipe named after its streamer.` + helpOptionUsage
+
+	compileUsageString = `
+
+Usage: %[1]v compile [options] path...
+
+Arguments
+
+	path          :   Video file, or directory whose .mp4, .mov, .mkv and .webm files are
+	                  compiled in the order of their names. Files are compiled in the order
+	                  they are given and are never removed. [required]
+
+Options
+` + compilerOptionsUsage + configOptionsUsage + helpOptionUsage
+
+	authLoginUsageString = `
+
+Usage: %[1]v auth login [options]
+
+Checks the credentials of your twitch application and stores them, together with the app
+access token issued for them, in a file only you can read. The token is reused until it
+expires. The client secret is read from TWITCH_CLIENT_SECRET, or asked for without
+being shown as it is typed.
+
+Options
+
+	--client-id   :   Client ID of the twitch application. Defaults to TWITCH_CLIENT_ID,
+	                  or is asked for.
+	--user        :   Log in as a twitch user instead, by entering a code on twitch.tv. The user
+	                  token is needed for --followed and is refreshed automatically. The client
+	                  secret is only used if TWITCH_CLIENT_SECRET is set or one is stored.` + helpOptionUsage
+
+	authStatusUsageString = `
+
+Usage: %[1]v auth status
+
+Options
+` + helpOptionUsage
+
+	authLogoutUsageString = `
+
+Usage: %[1]v auth logout
+
+Options
+` + helpOptionUsage
+
+	configValidateUsageString = `
+
+Usage: %[1]v config validate [options]
+
+Options
+
+	--config      :   Config file to check. Defaults to clipcompiler/config.yaml inside the user
+	                  config directory.` + helpOptionUsage
+)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/clipserver"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaapi"
+)
+
+const usageString = `
+
+Usage: %[1]v [options]
+
+Serves the web API on a single machine: POST /jobs accepts the same requests as the Lambda API,
+the clips are compiled in the background, GET /jobs/{id} reports the status of a job and the
+compilations are served under /files/.
+The twitch credentials are read from TWITCH_CLIENT_ID and TWITCH_CLIENT_SECRET.
+Clients are rate limited like on Lambda, as set by RATE_LIMIT_PER_MINUTE, DAILY_QUOTA,
+API_KEY_RATE_LIMIT_PER_MINUTE, API_KEY_DAILY_QUOTA and API_KEYS. A limit of 0 turns it off.
+
+Options
+
+	--addr        :   Address to listen on. Default is ":8080".
+	--data-dir    :   Directory for job results and compilations. Default is "clipserver-data".
+	--public-url  :   URL clients reach the server at, used in download links. Defaults to
+	                  http://localhost with the port of --addr.
+	--ffmpeg      :   Path of the ffmpeg executable. Default is "ffmpeg".
+	--workers     :   Number of requests compiled at the same time. Default is 1.
+	--queue-size  :   Number of requests that can wait to be compiled. Further requests are
+	                  rejected with 503 Service Unavailable until there is room. Default is 100.
+	--max-count   :   Most clips a compilation can have. Default is 10.
+	--max-range   :   Most days a request can span, counting both dates. Default is 31.
+	--help        :   Displays this message and exits the program.
+
+`
+
+func main() {
+	programName := filepath.Base(os.Args[0])
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usageString, programName)
+	}
+	addr := flag.String("addr", ":8080", "")
+	dataDir := flag.String("data-dir", "clipserver-data", "")
+	publicURL := flag.String("public-url", "", "")
+	ffmpegPath := flag.String("ffmpeg", "ffmpeg", "")
+	workers := flag.Int("workers", 1, "")
+	queueSize := flag.Int("queue-size", 100, "")
+	maxCount := flag.Int("max-count", jobs.DefaultLimits().MaxCount, "")
+	maxRange := flag.Int("max-range", jobs.DefaultLimits().MaxRangeDays, "")
+	flag.Parse()
+
+	if *maxCount < 1 || *maxRange < 1 {
+		log.Fatal("--max-count and --max-range must be positive")
+	}
+
+	if *publicURL == "" {
+		_, port, err := net.SplitHostPort(*addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*publicURL = "http://localhost:" + port
+	}
+
+	rateLimits, err := lambdaapi.RateLimitsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := clipserver.New(clipserver.Config{
+		DataDir:    *dataDir,
+		PublicURL:  *publicURL,
+		FFmpegPath: *ffmpegPath,
+		QueueSize:  *queueSize,
+		Limits:     jobs.Limits{MaxCount: *maxCount, MaxRangeDays: *maxRange},
+		RateLimits: &rateLimits,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(*workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.Work(ctx)
+		}()
+	}
+
+	httpServer := &http.Server{Addr: *addr, Handler: server}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %v, serving downloads from %v", *addr, *publicURL)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	wg.Wait()
+}
@@ -3,6 +3,7 @@ module github.com/jaaanko/twitch-clip-compilation-tool
 go 1.21.1
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/aws/aws-lambda-go v1.43.0
 	github.com/aws/aws-sdk-go-v2/config v1.26.2
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.12.13
@@ -11,6 +12,8 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.47.7
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.29.6
 	github.com/google/uuid v1.5.0
+	golang.org/x/term v0.19.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -33,4 +36,5 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sts v1.26.6 // indirect
 	github.com/aws/smithy-go v1.19.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/sys v0.19.0 // indirect
 )
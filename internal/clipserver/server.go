@@ -0,0 +1,243 @@
+// Package clipserver serves the web API of the Lambda stack over net/http, so
+// that it can run on a single machine. Requests are handled by the same
+// handlers as on Lambda, with an in-process queue in place of SQS, job
+// results stored as files in place of DynamoDB and compilations served from
+// disk in place of S3.
+package clipserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/apigateway"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaapi"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaprocessor"
+)
+
+// maxRequestBodySize is far above any valid request, which is a few fields of JSON.
+const maxRequestBodySize = 1 << 20
+
+type Config struct {
+	// DataDir holds the job results, the compilations and their work files.
+	DataDir string
+	// PublicURL is the address clients reach the server at, which download
+	// URLs are built from.
+	PublicURL  string
+	FFmpegPath string
+	// QueueSize is the number of requests that can wait to be processed.
+	QueueSize int
+	// Limits bounds the requests that are accepted. The zero value stands
+	// for jobs.DefaultLimits.
+	Limits jobs.Limits
+	// RateLimits bounds the jobs clients can create, which are counted in
+	// memory. Clients are not limited when it is nil.
+	RateLimits *lambdaapi.RateLimits
+}
+
+type Server struct {
+	api      func(ctx context.Context, event *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error)
+	process  func(ctx context.Context, event *events.SQSEvent) error
+	queue    *jobs.MemoryQueue
+	filesDir string
+	mux      *http.ServeMux
+}
+
+func New(cfg Config) (*Server, error) {
+	filesDir := filepath.Join(cfg.DataDir, "files")
+	jobsDir := filepath.Join(cfg.DataDir, "jobs")
+	workDir := filepath.Join(cfg.DataDir, "work")
+	for _, dir := range []string{filesDir, jobsDir, workDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, err
+		}
+	}
+
+	queue := jobs.NewMemoryQueue(max(cfg.QueueSize, 1))
+	store := jobs.NewFileStore(jobsDir)
+	if err := failUnfinishedJobs(context.Background(), store); err != nil {
+		return nil, err
+	}
+	limits := cfg.Limits
+	if limits == (jobs.Limits{}) {
+		limits = jobs.DefaultLimits()
+	}
+	options := []lambdaprocessor.Option{lambdaprocessor.WithOutputDir(workDir), lambdaprocessor.WithLimits(limits)}
+	if cfg.FFmpegPath != "" {
+		options = append(options, lambdaprocessor.WithFFmpegPath(cfg.FFmpegPath))
+	}
+
+	apiOptions := []lambdaapi.Option{lambdaapi.WithLimits(limits)}
+	if cfg.RateLimits != nil {
+		apiOptions = append(apiOptions, lambdaapi.WithRateLimits(jobs.NewMemoryStore(), *cfg.RateLimits))
+	}
+
+	s := &Server{
+		api: lambdaapi.NewHandlerWith(store, queue, apiOptions...),
+		process: lambdaprocessor.NewHandlerWith(
+			store,
+			jobs.NewFileBlobStore(filesDir, strings.TrimSuffix(cfg.PublicURL, "/")+"/files/"),
+			options...,
+		),
+		queue:    queue,
+		filesDir: filesDir,
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.Handle("/files/", http.StripPrefix("/files/", noDirectoryListing(http.FileServer(http.Dir(filesDir)))))
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Work processes queued requests one at a time until ctx is canceled.
+func (s *Server) Work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-s.queue.Messages():
+			event := &events.SQSEvent{Records: []events.SQSMessage{{Body: body}}}
+			if err := s.process(ctx, event); err != nil {
+				log.Printf("unable to process request: %v", err)
+			}
+		}
+	}
+}
+
+// failUnfinishedJobs marks the jobs that were queued or processing when the
+// server last stopped as failed. The queue is kept in memory, so they would
+// otherwise never finish.
+func failUnfinishedJobs(ctx context.Context, store jobs.FileStore) error {
+	items, err := store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to read jobs: %w", err)
+	}
+
+	errorMsg := "the server stopped before the job finished, please request it again"
+	for _, item := range items {
+		if item.Status != jobs.StatusQueued && item.Status != jobs.StatusProcessing {
+			continue
+		}
+		item.Status = jobs.StatusFailed
+		item.ErrorMsg = &errorMsg
+		if err := store.Put(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleJobs accepts compilation requests, like the API Gateway routes of the Lambda stack.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeResponse(w, apigateway.NewResponse(
+			http.StatusMethodNotAllowed, apigateway.NewErrorJSONString(fmt.Errorf("method %v not allowed", r.Method)),
+		))
+		return
+	}
+
+	s.serveAPI(w, r, nil)
+}
+
+// handleJob returns the status of the job at /jobs/{id}.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeResponse(w, apigateway.NewResponse(
+			http.StatusMethodNotAllowed, apigateway.NewErrorJSONString(fmt.Errorf("method %v not allowed", r.Method)),
+		))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveAPI(w, r, map[string]string{"id": id})
+}
+
+// serveAPI passes r to the API handler, together with the parameters API
+// Gateway would have taken from the path.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, pathParameters map[string]string) {
+	event, err := newEvent(r)
+	if err != nil {
+		writeResponse(w, apigateway.NewResponse(http.StatusBadRequest, apigateway.NewErrorJSONString(err)))
+		return
+	}
+	event.PathParameters = pathParameters
+
+	resp, err := s.api(r.Context(), event)
+	if err != nil {
+		writeResponse(w, apigateway.NewResponse(http.StatusInternalServerError, apigateway.NewErrorJSONString(err)))
+		return
+	}
+	writeResponse(w, resp)
+}
+
+// newEvent turns r into the event API Gateway would pass to the handler.
+func newEvent(r *http.Request) (*events.APIGatewayV2HTTPRequest, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read request body: %w", err)
+	}
+
+	headers := map[string]string{}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	sourceIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+
+	return &events.APIGatewayV2HTTPRequest{
+		RawPath:        r.URL.Path,
+		RawQueryString: r.URL.RawQuery,
+		Headers:        headers,
+		Body:           string(body),
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				SourceIP:  sourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}, nil
+}
+
+// noDirectoryListing hides the list of files, like the S3 bucket does.
+// Compilations are named after a random ID, so only their requester knows them.
+func noDirectoryListing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeResponse(w http.ResponseWriter, resp *events.APIGatewayV2HTTPResponse) {
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.WriteString(w, resp.Body)
+}
@@ -0,0 +1,253 @@
+package clipserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/clipserver"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaapi"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitchtest"
+)
+
+var sample = filepath.Join("..", "compiler", "testdata", "sample1.mp4")
+
+func testServer(t *testing.T, dataDir string, options ...func(cfg *clipserver.Config)) *httptest.Server {
+	var server *clipserver.Server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	cfg := clipserver.Config{
+		DataDir:   dataDir,
+		PublicURL: ts.URL,
+		// Both clips of the fake twitch server are the same sample file, so
+		// the jobs the server works on never need ffmpeg.
+		FFmpegPath: filepath.Join(dataDir, "missing-ffmpeg"),
+		QueueSize:  1,
+	}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
+	var err error
+	server, err = clipserver.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.Work(ctx)
+
+	return ts
+}
+
+func TestServer(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	ts := testServer(t, t.TempDir())
+
+	res, err := http.Post(ts.URL+"/jobs", "application/json",
+		strings.NewReader(`{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status %v, got %v", http.StatusAccepted, res.StatusCode)
+	}
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&accepted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(accepted.ID, "streamer1-") {
+		t.Fatalf("unexpected job ID %q", accepted.ID)
+	}
+
+	var result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		URL    string `json:"url"`
+		Error  string `json:"error"`
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		res, err := http.Get(ts.URL + "/jobs/" + accepted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %v, got %v", http.StatusOK, res.StatusCode)
+		}
+
+		if result.Status != "queued" && result.Status != "processing" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the job was not processed in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if result.ID != accepted.ID || result.Status != "done" || result.URL == "" {
+		t.Fatalf("expected the job to be done, got %+v", result)
+	}
+
+	download, err := http.Get(result.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer download.Body.Close()
+	if download.StatusCode != http.StatusOK || download.Header.Get("Content-Type") != "video/mp4" {
+		t.Fatalf("expected the compilation to be served, got status %v and type %v",
+			download.StatusCode, download.Header.Get("Content-Type"))
+	}
+
+	// The list of compilations is not public.
+	listing, err := http.Get(ts.URL + "/files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing.Body.Close()
+	if listing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the file listing to be hidden, got status %v", listing.StatusCode)
+	}
+}
+
+func TestServerRejectsInvalidRequests(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	ts := testServer(t, t.TempDir())
+
+	tests := map[string]struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		"malformed body": {
+			method: http.MethodPost,
+			body:   `{"username":`,
+			want:   http.StatusBadRequest,
+		},
+		"unknown streamer": {
+			method: http.MethodPost,
+			body:   `{"username": "nobody", "start": "2023-01-01", "end": "2023-01-07", "count": 2}`,
+			want:   http.StatusBadRequest,
+		},
+		"wrong method": {
+			method: http.MethodPut,
+			want:   http.StatusMethodNotAllowed,
+		},
+		"unknown job": {
+			method: http.MethodGet,
+			path:   "/streamer1-123",
+			want:   http.StatusNotFound,
+		},
+		"job with wrong method": {
+			method: http.MethodPost,
+			path:   "/streamer1-123",
+			want:   http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+"/jobs"+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.want {
+				t.Fatalf("expected status %v, got %v", tc.want, res.StatusCode)
+			}
+
+			var body struct {
+				ErrMsg string `json:"error_message"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.ErrMsg == "" {
+				t.Fatalf("expected an error message, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServerRateLimits(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	ts := testServer(t, t.TempDir(), func(cfg *clipserver.Config) {
+		cfg.RateLimits = &lambdaapi.RateLimits{IP: lambdaapi.Quota{PerMinute: 1}}
+	})
+
+	for _, want := range []int{http.StatusBadRequest, http.StatusTooManyRequests} {
+		res, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(`{"username":`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != want {
+			t.Fatalf("expected status %v, got %v", want, res.StatusCode)
+		}
+		if want == http.StatusTooManyRequests && res.Header.Get("Retry-After") == "" {
+			t.Fatal("expected a Retry-After header")
+		}
+	}
+}
+
+func TestServerFailsUnfinishedJobs(t *testing.T) {
+	dataDir := t.TempDir()
+	jobsDir := filepath.Join(dataDir, "jobs")
+	if err := os.MkdirAll(jobsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store := jobs.NewFileStore(jobsDir)
+	for _, status := range []jobs.Status{jobs.StatusQueued, jobs.StatusProcessing} {
+		if err := store.Put(context.Background(), jobs.Item{ID: "streamer1-" + status.String(), Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The jobs were left behind by an earlier server, whose queue is gone.
+	twitchtest.Serve(t, sample)
+	ts := testServer(t, dataDir)
+
+	for _, status := range []jobs.Status{jobs.StatusQueued, jobs.StatusProcessing} {
+		res, err := http.Get(ts.URL + "/jobs/streamer1-" + status.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Status != jobs.StatusFailed.String() || result.Error == "" {
+			t.Fatalf("expected the %v job to have failed with a message, got %+v", status, result)
+		}
+	}
+}
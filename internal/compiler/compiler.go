@@ -2,22 +2,66 @@ package compiler
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
 )
 
 type compiler struct {
 	outputDir      string
 	outputFileName string
 	ffmpegPath     string
+	ffprobePath    string
 	cleanup        bool
+	vertical       *Vertical
+	preset         Preset
+	maxSize        ByteSize
+	container      string
+	preview        *Preview
+	thumbnail      *Thumbnail
+	sectionCards   *SectionCards
+	transition     *Transition
+	nativeConcat   bool
+	workers        int
+	strict         bool
+	// workDir holds the intermediate files of a run. Finished files are
+	// moved from it into outputDir, so that a failed run never leaves a
+	// partial output behind.
+	workDir string
+	// ctx is the context of the current run, which stops ffmpeg when canceled.
+	ctx context.Context
+}
+
+// Clip is a file to include in the compilation. Clips passed to RunStream can
+// arrive in any order; Index is the clip's position in the compilation.
+type Clip struct {
+	Index int
+	Path  string
+	// Section is the title of the part of the compilation the clip belongs
+	// to. With section cards, a card is shown before the first clip of every
+	// section.
+	Section string
+	// Views is the view count of the clip, which picks the clip of a
+	// TopClip thumbnail. It is zero for clips not fetched from twitch.
+	Views int
+	// Err is set instead of Path for a clip that could not be obtained, such
+	// as a failed download. The clip is listed with the skipped clips.
+	Err error
 }
 
+// Option configures a compiler created with New.
+type Option = func(*compiler)
+
 const fileListName = "list.txt"
 
 func New(options ...func(*compiler)) compiler {
@@ -25,7 +69,12 @@ func New(options ...func(*compiler)) compiler {
 		outputDir:      "out",
 		outputFileName: "compilation.mp4",
 		ffmpegPath:     "ffmpeg",
+		ffprobePath:    "ffprobe",
 		cleanup:        true,
+		preset:         builtinPresets[DefaultPresetName],
+		nativeConcat:   true,
+		workers:        runtime.GOMAXPROCS(0),
+		ctx:            context.Background(),
 	}
 
 	for _, opt := range options {
@@ -53,80 +102,273 @@ func WithFFmpegPath(ffmpegPath string) func(*compiler) {
 	}
 }
 
+func WithFFprobePath(ffprobePath string) func(*compiler) {
+	return func(c *compiler) {
+		c.ffprobePath = ffprobePath
+	}
+}
+
+// WithNativeConcat controls whether clips sharing the same codec parameters
+// are joined in Go instead of through ffmpeg when the output is stream copied.
+func WithNativeConcat(nativeConcat bool) func(*compiler) {
+	return func(c *compiler) {
+		c.nativeConcat = nativeConcat
+	}
+}
+
+// WithWorkers sets how many clips are preprocessed at the same time.
+// Values below 1 are treated as 1.
+func WithWorkers(workers int) func(*compiler) {
+	return func(c *compiler) {
+		c.workers = max(workers, 1)
+	}
+}
+
 func WithCleanup(cleanup bool) func(*compiler) {
 	return func(c *compiler) {
 		c.cleanup = cleanup
 	}
 }
 
-func (c compiler) Run(filePaths []string) error {
-	modifiedFileNames, err := c.equalizeTimebase(filePaths)
+func (c compiler) Run(filePaths []string) (Report, error) {
+	clips := make([]Clip, len(filePaths))
+	for i, path := range filePaths {
+		clips[i] = Clip{Index: i, Path: path}
+	}
+	return c.RunStream(context.Background(), sendClips(clips))
+}
+
+// RunStream compiles the clips received from clips once the channel is closed.
+// Each clip is preprocessed as soon as it is received, so that preprocessing
+// overlaps with whatever produces the clips, such as their downloads.
+// Clips that fail to process or arrive with an error are left out and listed
+// in the report. A strict compiler fails instead, before anything is written
+// to the output directory. Canceling ctx stops the run, which then writes
+// nothing to the output directory either.
+func (c compiler) RunStream(ctx context.Context, clips <-chan Clip) (Report, error) {
+	c.ctx = ctx
+
+	if err := os.MkdirAll(c.outputDir, 0750); err != nil {
+		return Report{}, fmt.Errorf("unable to create output directory: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp(c.outputDir, ".compile-")
 	if err != nil {
-		return err
+		return Report{}, fmt.Errorf("unable to create working directory: %w", err)
 	}
+	defer os.RemoveAll(workDir)
+	c.workDir = workDir
 
-	fileListPath, err := c.prepareFileList(modifiedFileNames)
+	clips, failed := skipFailed(clips)
+	if c.canConcatNatively() {
+		// Joining in Go needs no preprocessing, so it waits for every clip as
+		// long as they can all be joined. Anything it cannot handle, such as
+		// clips with different codec parameters, is left to ffmpeg, which
+		// starts on the clips as soon as one of them does not match.
+		received, rest := collectConcatenable(clips)
+		if rest != nil {
+			clips = rest
+		} else {
+			report := Report{Included: received, Skipped: failed()}
+			if c.strict && len(report.Skipped) > 0 {
+				return report, report.wrap(ErrClipFailed)
+			}
+			if len(received) == 0 {
+				return report, report.wrap(ErrNoClips)
+			}
+			if err := mp4.Concat(c.workPath(c.outputFileName), clipPaths(received)); err == nil {
+				return report, c.finishNative(received)
+			}
+			clips = sendClips(received)
+		}
+	}
+
+	// Failing to remove an original clip does not affect the compilation, so
+	// it is only reported once the compilation is done.
+	report, modifiedPaths, cleanupErr := c.equalizeTimebase(clips)
+	report.Skipped = append(report.Skipped, failed()...)
+	sort.Slice(report.Skipped, func(i, j int) bool {
+		return report.Skipped[i].Index < report.Skipped[j].Index
+	})
+
+	if c.strict && len(report.Skipped) > 0 {
+		return report, report.wrap(ErrClipFailed)
+	}
+	if len(report.Included) == 0 {
+		return report, report.wrap(ErrNoClips)
+	}
+
+	// Cards are part of the compilation, but not of its thumbnail.
+	compiledPaths := modifiedPaths
+	if c.sectionCards != nil {
+		compiledPaths, err = c.insertSectionCards(report.Included, modifiedPaths)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	var compiledFileNames []string
+	for _, path := range compiledPaths {
+		compiledFileNames = append(compiledFileNames, filepath.Base(path))
+	}
+
+	fileListPath, err := c.prepareFileList(compiledFileNames)
 	if err != nil {
-		return fmt.Errorf("unable to prepare file list: %v", err)
+		return report, fmt.Errorf("unable to prepare file list: %v", err)
 	}
 
-	cmd := exec.Command(
-		c.ffmpegPath, "-y", "-f", "concat", "-safe", "0", "-i",
-		fileListPath, "-c", "copy", filepath.Join(c.outputDir, c.outputFileName),
-	)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	if err := c.encode(fileListPath, compiledPaths); err != nil {
+		return report, fmt.Errorf("failed to compile clips: %w", err)
+	}
 
-	filesToRemove := []string{fileListPath}
-	for _, name := range modifiedFileNames {
-		filesToRemove = append(filesToRemove, filepath.Join(c.outputDir, name))
+	if err := c.publish(c.outputFileName); err != nil {
+		return report, err
 	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to compile clips: %v: %v", err, stderr.String())
+	return report, errors.Join(c.writeExtras(report.Included, modifiedPaths), cleanupErr)
+}
+
+func (c compiler) canConcatNatively() bool {
+	if !c.nativeConcat || c.vertical != nil || c.sectionCards != nil || c.transition != nil {
+		return false
+	}
+
+	preset := c.outputPreset()
+	return preset.copies() && preset.MaxSize == 0 && (preset.Container == "mp4" || preset.Container == "mov")
+}
+
+func (c compiler) finishNative(clips []Clip) error {
+	filePaths := clipPaths(clips)
+	if err := c.publish(c.outputFileName); err != nil {
+		return err
 	}
 
-	if err := removeAll(filesToRemove); err != nil {
+	if err := c.writeExtras(clips, filePaths); err != nil {
 		return err
 	}
 
+	if c.cleanup {
+		return removeAll(filePaths)
+	}
 	return nil
 }
 
-func (c compiler) equalizeTimebase(filePaths []string) ([]string, error) {
-	var modifiedFileNames []string
-	var errs error
+// workPath returns the path of a file in the working directory.
+func (c compiler) workPath(name string) string {
+	return filepath.Join(c.workDir, name)
+}
 
-	for _, path := range filePaths {
-		fileName := filepath.Base(path)
-		newFileName := fmt.Sprintf("%v_modified.mp4", strings.TrimSuffix(fileName, filepath.Ext(fileName)))
-		newPath := filepath.Join(c.outputDir, newFileName)
-		cmd := exec.Command(
-			c.ffmpegPath, "-i", path, "-c", "copy",
-			"-video_track_timescale", "15360", newPath,
-		)
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-
-		if err := cmd.Run(); err != nil {
-			errs = errors.Join(errs, fmt.Errorf("skipped %v: %v: %v", fileName, err, stderr.String()))
+// publish moves a finished file from the working directory into the output
+// directory. Both directories are on the same file system, so the file
+// appears there complete or not at all. Nothing is published once the run is
+// canceled.
+func (c compiler) publish(name string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Rename(c.workPath(name), filepath.Join(c.outputDir, name)); err != nil {
+		return fmt.Errorf("unable to move %v to the output directory: %w", name, err)
+	}
+	return nil
+}
+
+// writeExtras writes the optional files that accompany the compilation.
+// clipPaths[i] is the file of clips[i] that went into the compilation.
+func (c compiler) writeExtras(clips []Clip, clipPaths []string) error {
+	if c.preview != nil {
+		if err := c.writePreview(); err != nil {
+			return fmt.Errorf("failed to create preview: %w", err)
+		}
+	}
+
+	if c.thumbnail != nil {
+		if err := c.writeThumbnail(clips, clipPaths); err != nil {
+			return fmt.Errorf("failed to create thumbnail: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// equalizeTimebase rewrites every clip to a common timescale so that the concat
+// demuxer can join them. Clips are processed by a pool of workers as they are
+// received. The report lists the clips by their indexes, and the paths of the
+// rewritten clips are in the same order as report.Included. The returned
+// error is only about removing the original clips.
+func (c compiler) equalizeTimebase(clips <-chan Clip) (Report, []string, error) {
+	type result struct {
+		clip     Clip
+		modified string
+		err      error
+	}
+
+	var mu sync.Mutex
+	var results []result
+	var cleanupErrs []error
+	var wg sync.WaitGroup
+	for w := 0; w < c.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for clip := range clips {
+				modified, err := c.equalizeClipTimebase(clip)
+				var cleanupErr error
+				if c.cleanup {
+					cleanupErr = os.Remove(clip.Path)
+				}
 
-		if c.cleanup {
-			err := os.Remove(path)
-			if err != nil {
-				errs = errors.Join(errs, err)
+				mu.Lock()
+				results = append(results, result{clip: clip, modified: modified, err: err})
+				if cleanupErr != nil {
+					cleanupErrs = append(cleanupErrs, cleanupErr)
+				}
+				mu.Unlock()
 			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].clip.Index < results[j].clip.Index
+	})
+
+	var report Report
+	var modifiedPaths []string
+	for _, r := range results {
+		if r.err != nil {
+			report.Skipped = append(report.Skipped, SkippedClip{Clip: r.clip, Err: r.err})
+			continue
 		}
+		report.Included = append(report.Included, r.clip)
+		modifiedPaths = append(modifiedPaths, r.modified)
+	}
+
+	return report, modifiedPaths, errors.Join(cleanupErrs...)
+}
 
-		modifiedFileNames = append(modifiedFileNames, newFileName)
+// equalizeClipTimebase rewrites a single clip and returns the path of the result.
+func (c compiler) equalizeClipTimebase(clip Clip) (string, error) {
+	fileName := filepath.Base(clip.Path)
+	// Clips may come from different directories with the same file name, so
+	// the index keeps the names of the rewritten clips apart.
+	newFileName := fmt.Sprintf("%03d_%v.mp4", clip.Index, strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	newPath := c.workPath(newFileName)
+	cmd := exec.CommandContext(c.ctx,
+		c.ffmpegPath, "-nostdin", "-y", "-i", clip.Path, "-c", "copy",
+		"-video_track_timescale", "15360", newPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v: %v: %v", fileName, err, stderr.String())
 	}
 
-	return modifiedFileNames, errs
+	return newPath, nil
 }
 
 func (c compiler) prepareFileList(fileNames []string) (string, error) {
-	path := filepath.Join(c.outputDir, fileListName)
+	path := c.workPath(fileListName)
 	fileList, err := os.Create(path)
 	if err != nil {
 		return "", err
@@ -153,6 +395,78 @@ func appendFileNames(fileNames []string, dest io.Writer) error {
 	return nil
 }
 
+func sendClips(clips []Clip) <-chan Clip {
+	ch := make(chan Clip, len(clips))
+	for _, clip := range clips {
+		ch <- clip
+	}
+	close(ch)
+	return ch
+}
+
+// collectConcatenable waits for every clip and returns them in compilation
+// order, as long as each clip can be joined natively with the first one
+// received. Otherwise it stops at the first clip that cannot and returns a
+// channel of every clip, those already received included.
+func collectConcatenable(clips <-chan Clip) ([]Clip, <-chan Clip) {
+	var received []Clip
+	for clip := range clips {
+		if len(received) > 0 && mp4.Compatible(received[0].Path, clip.Path) != nil {
+			return nil, prependClips(append(received, clip), clips)
+		}
+		received = append(received, clip)
+	}
+
+	sort.Slice(received, func(i, j int) bool {
+		return received[i].Index < received[j].Index
+	})
+	return received, nil
+}
+
+// skipFailed returns a channel of the clips received from clips that have no
+// error. Once that channel is drained, failed returns the others as skipped
+// clips.
+func skipFailed(clips <-chan Clip) (<-chan Clip, func() []SkippedClip) {
+	ch := make(chan Clip)
+	var skipped []SkippedClip
+	go func() {
+		defer close(ch)
+		for clip := range clips {
+			if clip.Err != nil {
+				skipped = append(skipped, SkippedClip{Clip: clip, Err: clip.Err})
+				continue
+			}
+			ch <- clip
+		}
+	}()
+	return ch, func() []SkippedClip {
+		return skipped
+	}
+}
+
+// prependClips returns a channel of first followed by the clips received from rest.
+func prependClips(first []Clip, rest <-chan Clip) <-chan Clip {
+	ch := make(chan Clip, len(first))
+	for _, clip := range first {
+		ch <- clip
+	}
+	go func() {
+		defer close(ch)
+		for clip := range rest {
+			ch <- clip
+		}
+	}()
+	return ch
+}
+
+func clipPaths(clips []Clip) []string {
+	var paths []string
+	for _, clip := range clips {
+		paths = append(paths, clip.Path)
+	}
+	return paths
+}
+
 func removeAll(filePaths []string) error {
 	var errs error
 	for _, path := range filePaths {
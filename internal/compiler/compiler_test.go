@@ -1,7 +1,9 @@
 package compiler_test
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
@@ -20,7 +22,7 @@ func TestRun(t *testing.T) {
 		filepath.Join("testdata", "sample2.mp4"),
 	}
 
-	err := compiler.Run(paths)
+	_, err := compiler.Run(paths)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -44,3 +46,104 @@ func TestRun(t *testing.T) {
 		t.Fatalf("expected output file to be called %v, got %v", outputName, fileNames[0])
 	}
 }
+
+func TestRunNativeConcat(t *testing.T) {
+	outputDir := t.TempDir()
+	outputName := "compilation.mp4"
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+		// Clips sharing codec parameters must not need ffmpeg at all.
+		compiler.WithFFmpegPath(filepath.Join(outputDir, "missing-ffmpeg")),
+	)
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		filepath.Join("testdata", "sample1.mp4"),
+	}
+
+	if _, err := clipCompiler.Run(paths); err != nil {
+		t.Fatal(err)
+	}
+
+	fileNames, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fileNames) != 1 || fileNames[0].Name() != outputName {
+		t.Fatalf("expected only %v in the output directory, got %v", outputName, fileNames)
+	}
+}
+
+func TestRunFailureLeavesNoFiles(t *testing.T) {
+	outputDir := t.TempDir()
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+		compiler.WithNativeConcat(false),
+		compiler.WithFFmpegPath(filepath.Join(outputDir, "missing-ffmpeg")),
+	)
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		filepath.Join("testdata", "sample2.mp4"),
+	}
+
+	if _, err := clipCompiler.Run(paths); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	fileNames, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fileNames) != 0 {
+		t.Fatalf("expected the output directory to be empty, got %v", fileNames)
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%v workers", workers), func(t *testing.T) {
+			outputDir := t.TempDir()
+			clipCompiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithCleanup(false),
+				compiler.WithWorkers(workers),
+			)
+			paths := []string{
+				filepath.Join("testdata", "sample1.mp4"),
+				filepath.Join("testdata", "sample2.mp4"),
+			}
+
+			if _, err := clipCompiler.Run(paths); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(filepath.Join(outputDir, "compilation.mp4")); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// probeVideo returns the codec and dimensions of the first video stream of
+// the file at path.
+func probeVideo(t *testing.T, path string) (string, int, int) {
+	t.Helper()
+	out, err := exec.Command(
+		"ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,width,height",
+		"-of", "default=noprint_wrappers=1:nokey=1", path,
+	).Output()
+	if err != nil {
+		t.Fatalf("unable to probe %v: %v", path, err)
+	}
+
+	var codec string
+	var width, height int
+	if _, err := fmt.Sscan(string(out), &codec, &width, &height); err != nil {
+		t.Fatalf("unexpected ffprobe output %q: %v", out, err)
+	}
+	return codec, width, height
+}
@@ -0,0 +1,307 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
+)
+
+const (
+	defaultAudioBitrate = 128_000
+	// Lowest video bitrate in bits per second that still produces a watchable video.
+	minVideoBitrate = 100_000
+	// Share of the size limit reserved for the container and rate control overshoot.
+	sizeOverhead = 0.04
+)
+
+// bitrateUnits are the multipliers of the bitrate suffixes ParseBitrate accepts.
+var bitrateUnits = map[string]float64{"k": 1000, "m": 1000 * 1000, "g": 1000 * 1000 * 1000}
+
+var ErrMaxSizeInfeasible = errors.New("compilation cannot fit in the requested size")
+
+// WithContainer overrides the container of the preset. Without it, the
+// container is chosen from the output file's extension, then the preset.
+func WithContainer(container string) func(*compiler) {
+	return func(c *compiler) {
+		c.container = container
+	}
+}
+
+func WithMaxSize(maxSize ByteSize) func(*compiler) {
+	return func(c *compiler) {
+		c.maxSize = maxSize
+	}
+}
+
+// encode writes the final compilation from the concat list. clipPaths are the
+// files referenced by the list, which are read directly when they are joined
+// with transitions.
+func (c compiler) encode(fileListPath string, clipPaths []string) error {
+	preset := c.outputPreset()
+
+	outputPath := c.workPath(c.outputFileName)
+	inputArgs := []string{"-y", "-f", "concat", "-safe", "0", "-i", fileListPath}
+	graph := ""
+	var durations []float64
+	if c.joinsWithTransitions(clipPaths) || preset.MaxSize > 0 {
+		var err error
+		if durations, err = c.clipDurations(clipPaths); err != nil {
+			return err
+		}
+	}
+	if c.joinsWithTransitions(clipPaths) {
+		args, transitionGraph, err := c.transitionInput(preset, clipPaths, durations)
+		if err != nil {
+			return err
+		}
+		inputArgs = append([]string{"-y"}, args...)
+		graph = transitionGraph
+	}
+
+	if preset.MaxSize == 0 {
+		return c.ffmpeg(append(append(inputArgs, c.outputArgs(preset, graph)...), outputPath)...)
+	}
+
+	preset, err := preset.FitToSize(c.outputDuration(durations))
+	if err != nil {
+		return err
+	}
+
+	passLogPrefix := c.workPath("passlog")
+
+	firstPass := append([]string{}, inputArgs...)
+	firstPass = append(firstPass, c.videoArgs(preset, graph)...)
+	if graph != "" {
+		// Every output of the filter graph has to be used, audio included.
+		firstPass = append(firstPass, c.audioArgs(preset, graph)...)
+	} else {
+		firstPass = append(firstPass, "-an")
+	}
+	firstPass = append(firstPass, "-pass", "1", "-passlogfile", passLogPrefix, "-f", "null", os.DevNull)
+	if err := c.ffmpeg(firstPass...); err != nil {
+		return fmt.Errorf("first pass failed: %w", err)
+	}
+
+	secondPass := append([]string{}, inputArgs...)
+	secondPass = append(secondPass, c.outputArgs(preset, graph)...)
+	secondPass = append(secondPass, "-pass", "2", "-passlogfile", passLogPrefix, outputPath)
+	if err := c.ffmpeg(secondPass...); err != nil {
+		return fmt.Errorf("second pass failed: %w", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return err
+	}
+	if ByteSize(info.Size()) > preset.MaxSize {
+		return fmt.Errorf("%w: output is %v bytes, limit is %v bytes", ErrMaxSizeInfeasible, info.Size(), preset.MaxSize)
+	}
+
+	return nil
+}
+
+// clipDurations returns the duration of every clip in seconds.
+func (c compiler) clipDurations(clipPaths []string) ([]float64, error) {
+	var durations []float64
+	for _, path := range clipPaths {
+		d, err := c.probeDuration(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to measure duration of %v: %w", filepath.Base(path), err)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// outputDuration returns the duration of the compilation of clips with the given durations.
+func (c compiler) outputDuration(durations []float64) float64 {
+	var duration float64
+	for _, d := range durations {
+		duration += d
+	}
+	if c.transition != nil {
+		for _, overlap := range c.transitionDurations(durations) {
+			duration -= overlap
+		}
+	}
+	if c.vertical != nil {
+		duration = math.Min(duration, maxVerticalDuration)
+	}
+	return duration
+}
+
+// outputPreset returns the preset adjusted for the chosen container and size limit.
+func (c compiler) outputPreset() Preset {
+	preset := c.preset
+	if c.maxSize > 0 {
+		preset.MaxSize = c.maxSize
+	}
+
+	container := c.container
+	if container == "" {
+		container = ContainerFromFileName(c.outputFileName)
+	}
+	return preset.withContainer(container)
+}
+
+// FitToSize returns p with the video bitrate that makes a compilation of the
+// given duration in seconds land under p.MaxSize. A lower video bitrate set
+// by p is kept.
+func (p Preset) FitToSize(duration float64) (Preset, error) {
+	if duration <= 0 {
+		return p, fmt.Errorf("%w: clips have no duration", ErrMaxSizeInfeasible)
+	}
+
+	preset := p.encoding()
+	audioBitrate := int64(defaultAudioBitrate)
+	if preset.AudioBitrate != "" {
+		bitrate, err := ParseBitrate(preset.AudioBitrate)
+		if err != nil {
+			return preset, err
+		}
+		audioBitrate = bitrate
+	}
+
+	totalBitrate := float64(preset.MaxSize) * 8 * (1 - sizeOverhead) / duration
+	videoBitrate := int64(totalBitrate) - audioBitrate
+	if videoBitrate < minVideoBitrate {
+		return preset, fmt.Errorf(
+			"%w: %.0f seconds of video in %v bytes leaves %v kbps for video, at least %v kbps is needed",
+			ErrMaxSizeInfeasible, duration, preset.MaxSize, max(videoBitrate, 0)/1000, minVideoBitrate/1000,
+		)
+	}
+
+	if preset.VideoBitrate != "" {
+		bitrate, err := ParseBitrate(preset.VideoBitrate)
+		if err != nil {
+			return preset, err
+		}
+		videoBitrate = min(videoBitrate, bitrate)
+	}
+
+	preset.VideoBitrate = fmt.Sprintf("%vk", videoBitrate/1000)
+	return preset, nil
+}
+
+// outputArgs returns the ffmpeg output options for the final file, excluding
+// the output path. graph is the filter graph joining the clips, if any.
+func (c compiler) outputArgs(preset Preset, graph string) []string {
+	var args []string
+	if c.vertical == nil && c.sectionCards == nil && c.transition == nil && preset.copies() {
+		args = append(args, "-c", "copy")
+	} else {
+		preset = preset.encoding()
+		args = append(args, c.videoArgs(preset, graph)...)
+		args = append(args, c.audioArgs(preset, graph)...)
+	}
+
+	return append(args, preset.containerArgs()...)
+}
+
+func (c compiler) videoArgs(preset Preset, graph string) []string {
+	var args []string
+	if graph != "" {
+		// The clips are already scaled to the preset while they are joined.
+		filter, out := graph, "joined"
+		if c.vertical != nil {
+			filter, out = graph+";"+c.vertical.filterFrom(out), "v"
+		}
+		args = append(args, "-filter_complex", filter, "-map", "["+out+"]")
+		if c.vertical != nil {
+			args = append(args, "-t", strconv.Itoa(maxVerticalDuration))
+		}
+	} else if c.vertical != nil {
+		args = append(args,
+			"-filter_complex", c.vertical.filter(), "-map", "[v]",
+			"-t", strconv.Itoa(maxVerticalDuration),
+		)
+	} else if preset.Width > 0 && preset.Height > 0 {
+		args = append(args, "-vf", fmt.Sprintf(
+			"scale=%v:%v:force_original_aspect_ratio=decrease,pad=%v:%v:(ow-iw)/2:(oh-ih)/2,setsar=1",
+			preset.Width, preset.Height, preset.Width, preset.Height,
+		))
+	}
+
+	return append(args, preset.videoCodecArgs()...)
+}
+
+func (c compiler) audioArgs(preset Preset, graph string) []string {
+	var args []string
+	if graph != "" {
+		args = append(args, "-map", "[a]")
+	} else if c.vertical != nil {
+		// Streams are no longer picked automatically once a filter graph output is mapped.
+		args = append(args, "-map", "0:a?")
+	}
+	return append(args, preset.audioCodecArgs()...)
+}
+
+func (c compiler) probeDuration(path string) (float64, error) {
+	if info, err := mp4.Probe(path); err == nil {
+		return info.Duration.Seconds(), nil
+	}
+
+	cmd := exec.CommandContext(c.ctx,
+		c.ffprobePath, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", err, stderr.String())
+	}
+
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+func (c compiler) ffmpeg(args ...string) error {
+	cmd := exec.CommandContext(c.ctx, c.ffmpegPath, append([]string{"-nostdin"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %v", err, stderr.String())
+	}
+	return nil
+}
+
+// ParseBitrate parses bitrates such as "128k", "6M" or "2m" into bits per
+// second. Unlike ffmpeg, which reads a lowercase m as milli, suffixes are not
+// case sensitive.
+func ParseBitrate(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	multiplier := 1.0
+	for suffix, m := range bitrateUnits {
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSuffix(value, suffix)
+			multiplier = m
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// ffmpegBitrate returns s in bits per second, so that ffmpeg reads it the
+// same way as ParseBitrate. s is returned as is if it cannot be parsed.
+func ffmpegBitrate(s string) string {
+	bitrate, err := ParseBitrate(s)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatInt(bitrate, 10)
+}
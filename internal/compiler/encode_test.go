@@ -0,0 +1,165 @@
+package compiler_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+func TestRunMaxSize(t *testing.T) {
+	tests := map[string]struct {
+		maxSize    compiler.ByteSize
+		infeasible bool
+	}{
+		"output fits under the limit": {
+			maxSize: 2 * 1000 * 1000,
+		},
+		"limit is too small for the duration": {
+			maxSize:    10 * 1000,
+			infeasible: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			outputName := "compilation.mp4"
+			clipCompiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithOutputFileName(outputName),
+				compiler.WithCleanup(false),
+				compiler.WithMaxSize(tc.maxSize),
+			)
+			paths := []string{
+				filepath.Join("testdata", "sample1.mp4"),
+				filepath.Join("testdata", "sample2.mp4"),
+			}
+
+			_, err := clipCompiler.Run(paths)
+			if tc.infeasible {
+				if !errors.Is(err, compiler.ErrMaxSizeInfeasible) {
+					t.Fatalf("expected %v, got: %v", compiler.ErrMaxSizeInfeasible, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(filepath.Join(outputDir, outputName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compiler.ByteSize(info.Size()) > tc.maxSize {
+				t.Fatalf("expected output to be at most %v bytes, got %v", tc.maxSize, info.Size())
+			}
+		})
+	}
+}
+
+func TestParseBitrate(t *testing.T) {
+	type result struct {
+		bitrate  int64
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input string
+		want  result
+	}{
+		"kilobits":        {input: "128k", want: result{bitrate: 128_000}},
+		"uppercase kilo":  {input: "128K", want: result{bitrate: 128_000}},
+		"megabits":        {input: "6M", want: result{bitrate: 6_000_000}},
+		"lowercase mega":  {input: "2m", want: result{bitrate: 2_000_000}},
+		"fractional":      {input: "1.5M", want: result{bitrate: 1_500_000}},
+		"gigabits":        {input: "1g", want: result{bitrate: 1_000_000_000}},
+		"plain bits":      {input: "96000", want: result{bitrate: 96_000}},
+		"repeated suffix": {input: "2kk", want: result{hasError: true}},
+		"unknown suffix":  {input: "2x", want: result{hasError: true}},
+		"zero":            {input: "0k", want: result{hasError: true}},
+		"empty":           {input: "", want: result{hasError: true}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			bitrate, err := compiler.ParseBitrate(tc.input)
+			got := result{bitrate: bitrate, hasError: err != nil}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresetFitToSize(t *testing.T) {
+	twitter, err := compiler.LookupPreset(compiler.BuiltinPresets(), "twitter-720p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	discord, err := compiler.LookupPreset(compiler.BuiltinPresets(), "discord-8mb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		preset   compiler.Preset
+		duration float64
+		want     string
+		wantErr  error
+	}{
+		"capped by the preset bitrate": {
+			preset:   twitter,
+			duration: 60,
+			want:     "5000k",
+		},
+		"below the preset bitrate": {
+			preset:   twitter,
+			duration: 3600,
+		},
+		"no preset bitrate": {
+			preset:   discord,
+			duration: 60,
+		},
+		"infeasible": {
+			preset:   discord,
+			duration: 3600,
+			wantErr:  compiler.ErrMaxSizeInfeasible,
+		},
+		"no duration": {
+			preset:  discord,
+			wantErr: compiler.ErrMaxSizeInfeasible,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.preset.FitToSize(tc.duration)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if tc.want != "" && got.VideoBitrate != tc.want {
+				t.Fatalf("expected a video bitrate of %v, got %v", tc.want, got.VideoBitrate)
+			}
+
+			// Whatever the bitrate, the video and audio fit under the limit.
+			videoBitrate, err := compiler.ParseBitrate(got.VideoBitrate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			audioBitrate, err := compiler.ParseBitrate(got.AudioBitrate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := float64(videoBitrate+audioBitrate) / 8 * tc.duration; size > float64(tc.preset.MaxSize) {
+				t.Fatalf("expected at most %v bytes, got %.0f", tc.preset.MaxSize, size)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Preset describes how the final compilation is encoded.
+// A codec of "copy" keeps the clips' streams as they are.
+type Preset struct {
+	Container    string   `yaml:"container" toml:"container"`
+	VideoCodec   string   `yaml:"video_codec" toml:"video_codec"`
+	AudioCodec   string   `yaml:"audio_codec" toml:"audio_codec"`
+	VideoBitrate string   `yaml:"video_bitrate" toml:"video_bitrate"`
+	AudioBitrate string   `yaml:"audio_bitrate" toml:"audio_bitrate"`
+	Width        int      `yaml:"width" toml:"width"`
+	Height       int      `yaml:"height" toml:"height"`
+	MaxSize      ByteSize `yaml:"max_size" toml:"max_size"`
+}
+
+// ByteSize is a size in bytes that can be written as e.g. "8MB" or "512KiB".
+type ByteSize int64
+
+const DefaultPresetName = "archive-copy"
+
+var builtinPresets = map[string]Preset{
+	"archive-copy": {
+		Container:  "mp4",
+		VideoCodec: "copy",
+		AudioCodec: "copy",
+	},
+	"youtube-1080p": {
+		Container:    "mp4",
+		VideoCodec:   "libx264",
+		AudioCodec:   "aac",
+		VideoBitrate: "8M",
+		AudioBitrate: "192k",
+		Width:        1920,
+		Height:       1080,
+	},
+	"twitter-720p": {
+		Container:    "mp4",
+		VideoCodec:   "libx264",
+		AudioCodec:   "aac",
+		VideoBitrate: "5M",
+		AudioBitrate: "128k",
+		Width:        1280,
+		Height:       720,
+		MaxSize:      512 * 1000 * 1000,
+	},
+	"discord-8mb": {
+		Container:    "mp4",
+		VideoCodec:   "libx264",
+		AudioCodec:   "aac",
+		AudioBitrate: "96k",
+		Width:        1280,
+		Height:       720,
+		MaxSize:      8 * 1000 * 1000,
+	},
+}
+
+var containerFormats = map[string]string{
+	"mp4":  "mp4",
+	"mov":  "mov",
+	"mkv":  "matroska",
+	"webm": "webm",
+}
+
+var webmVideoCodecs = map[string]bool{"libvpx": true, "libvpx-vp9": true, "libaom-av1": true, "libsvtav1": true}
+var webmAudioCodecs = map[string]bool{"libopus": true, "libvorbis": true}
+
+var errUnknownPreset = errors.New("unknown preset")
+
+// ContainerFromFileName returns the container matching the extension of
+// fileName, or an empty string if the extension is not recognized.
+func ContainerFromFileName(fileName string) string {
+	container := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	if _, ok := containerFormats[container]; !ok {
+		return ""
+	}
+	return container
+}
+
+// ParseContainer validates a container name such as "mp4", "mkv" or "webm".
+func ParseContainer(s string) (string, error) {
+	container := strings.ToLower(strings.TrimSpace(s))
+	if _, ok := containerFormats[container]; !ok {
+		return "", fmt.Errorf("unsupported container %q, must be one of mp4, mov, mkv or webm", s)
+	}
+	return container, nil
+}
+
+// BuiltinPresets returns the presets that are always available.
+func BuiltinPresets() map[string]Preset {
+	return maps.Clone(builtinPresets)
+}
+
+// DefaultPresetsPath returns the location of the presets file in the user
+// config directory, such as ~/.config/clipcompiler/presets.yaml.
+func DefaultPresetsPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "clipcompiler", "presets.yaml")
+}
+
+// LoadPresets returns the builtin presets merged with the presets defined in
+// the YAML file at path, which map preset names to their settings.
+// A missing file is not an error.
+func LoadPresets(path string) (map[string]Preset, error) {
+	presets := BuiltinPresets()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return presets, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var userPresets map[string]Preset
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&userPresets); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to parse presets file %v: %v", path, err)
+	}
+
+	for name, preset := range userPresets {
+		if err := preset.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid preset %v: %v", name, err)
+		}
+		presets[name] = preset
+	}
+
+	return presets, nil
+}
+
+// LookupPreset finds a preset by name.
+func LookupPreset(presets map[string]Preset, name string) (Preset, error) {
+	preset, ok := presets[name]
+	if !ok {
+		return Preset{}, fmt.Errorf("%w: %v", errUnknownPreset, name)
+	}
+	return preset, nil
+}
+
+func (p Preset) Validate() error {
+	if _, ok := containerFormats[p.Container]; p.Container != "" && !ok {
+		return fmt.Errorf("unsupported container %q", p.Container)
+	}
+	if (p.VideoCodec == "") != (p.AudioCodec == "") ||
+		p.VideoCodec == "" && (p.Width > 0 || p.Height > 0 || p.VideoBitrate != "" || p.AudioBitrate != "") {
+		return errors.New("video and audio codecs must both be set to encode")
+	}
+	if (p.VideoCodec == "copy") != (p.AudioCodec == "copy") {
+		return errors.New("video and audio must either both be copied or both be encoded")
+	}
+	if p.copies() && (p.Width > 0 || p.Height > 0 || p.VideoBitrate != "" || p.AudioBitrate != "") {
+		return errors.New("resolution and bitrates cannot be set when streams are copied")
+	}
+	if (p.Width > 0) != (p.Height > 0) {
+		return errors.New("both width and height must be set")
+	}
+	if p.Width < 0 || p.Height < 0 || p.MaxSize < 0 {
+		return errors.New("width, height and max size cannot be negative")
+	}
+	for _, bitrate := range []string{p.VideoBitrate, p.AudioBitrate} {
+		if _, err := ParseBitrate(bitrate); bitrate != "" && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WithPreset(preset Preset) func(*compiler) {
+	return func(c *compiler) {
+		c.preset = preset
+	}
+}
+
+func (p Preset) copies() bool {
+	return p.VideoCodec == "" || p.VideoCodec == "copy"
+}
+
+// encoding returns p with codecs filled in for when the streams have to be
+// re-encoded even though p copies them.
+func (p Preset) encoding() Preset {
+	if p.copies() {
+		p.VideoCodec = "libx264"
+		p.AudioCodec = "aac"
+	}
+	return p
+}
+
+// withContainer returns p writing to container instead, switching to VP9 and
+// Opus when p's codecs cannot be stored in a WebM file.
+func (p Preset) withContainer(container string) Preset {
+	if container == "" {
+		return p
+	}
+
+	p.Container = container
+	if container == "webm" {
+		if !webmVideoCodecs[p.VideoCodec] || !webmAudioCodecs[p.AudioCodec] {
+			p.VideoCodec = "libvpx-vp9"
+			p.AudioCodec = "libopus"
+		}
+	}
+	return p
+}
+
+func (p Preset) videoCodecArgs() []string {
+	args := []string{"-c:v", p.VideoCodec}
+	if p.VideoBitrate != "" {
+		args = append(args, "-b:v", ffmpegBitrate(p.VideoBitrate))
+	} else if p.VideoCodec == "libvpx-vp9" {
+		// Constant quality mode, libvpx otherwise defaults to a very low bitrate.
+		args = append(args, "-crf", "32", "-b:v", "0")
+	}
+	if p.VideoCodec == "libvpx-vp9" {
+		args = append(args, "-row-mt", "1")
+	}
+	return args
+}
+
+func (p Preset) audioCodecArgs() []string {
+	args := []string{"-c:a", p.AudioCodec}
+	if p.AudioBitrate != "" {
+		args = append(args, "-b:a", ffmpegBitrate(p.AudioBitrate))
+	}
+	return args
+}
+
+func (p Preset) containerArgs() []string {
+	format, ok := containerFormats[p.Container]
+	if !ok {
+		return nil
+	}
+
+	args := []string{"-f", format}
+	if format == "mp4" || format == "mov" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return args
+}
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseByteSize parses sizes such as "25MB", "8mib" or "1000000".
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * float64(multiplier)), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
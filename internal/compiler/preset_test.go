@@ -0,0 +1,167 @@
+package compiler_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+func TestLoadPresets(t *testing.T) {
+	presets, err := compiler.LoadPresets(filepath.Join("testdata", "presets.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"archive-copy", "twitter-720p", "discord-8mb", "youtube-1080p", "mastodon-40mb"} {
+		if _, err := compiler.LookupPreset(presets, name); err != nil {
+			t.Fatalf("expected preset %v to exist: %v", name, err)
+		}
+	}
+
+	if got := presets["youtube-1080p"].VideoBitrate; got != "12M" {
+		t.Fatalf("expected user preset to override builtin, got video bitrate %v", got)
+	}
+
+	if got := presets["mastodon-40mb"].MaxSize; got != 40*1000*1000 {
+		t.Fatalf("expected max size of %v, got %v", 40*1000*1000, got)
+	}
+
+	if _, err := compiler.LookupPreset(presets, "unknown"); err == nil {
+		t.Fatal("expected an error for an unknown preset")
+	}
+}
+
+func TestLoadPresetsMissingFile(t *testing.T) {
+	presets, err := compiler.LoadPresets(filepath.Join(t.TempDir(), "presets.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(presets) != len(compiler.BuiltinPresets()) {
+		t.Fatalf("expected only builtin presets, got %v", presets)
+	}
+}
+
+func TestLoadPresetsInvalid(t *testing.T) {
+	tests := map[string]struct {
+		fileName string
+		want     string
+	}{
+		"invalid preset": {fileName: "presets_invalid.yaml", want: "broken"},
+		"unknown key":    {fileName: "presets_unknown_key.yaml", want: "video_bitrat"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := compiler.LoadPresets(filepath.Join("testdata", tc.fileName))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestPresetValidate(t *testing.T) {
+	tests := map[string]struct {
+		preset   compiler.Preset
+		hasError bool
+	}{
+		"copied streams": {
+			preset: compiler.Preset{Container: "mkv"},
+		},
+		"encoded streams": {
+			preset: compiler.Preset{VideoCodec: "libx264", AudioCodec: "aac", Width: 1280, Height: 720},
+		},
+		"resolution without codecs": {
+			preset:   compiler.Preset{Width: 1280, Height: 720},
+			hasError: true,
+		},
+		"bitrate without codecs": {
+			preset:   compiler.Preset{VideoBitrate: "4M"},
+			hasError: true,
+		},
+		"audio codec only": {
+			preset:   compiler.Preset{AudioCodec: "aac"},
+			hasError: true,
+		},
+		"video codec only": {
+			preset:   compiler.Preset{VideoCodec: "libx264"},
+			hasError: true,
+		},
+		"invalid bitrate": {
+			preset:   compiler.Preset{VideoCodec: "libx264", AudioCodec: "aac", VideoBitrate: "fast"},
+			hasError: true,
+		},
+		"one stream copied": {
+			preset:   compiler.Preset{VideoCodec: "copy", AudioCodec: "aac"},
+			hasError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.preset.Validate()
+			if hasError := err != nil; hasError != tc.hasError {
+				t.Fatalf("expected an error: %v, got: %v", tc.hasError, err)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	type result struct {
+		size     compiler.ByteSize
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input string
+		want  result
+	}{
+		"megabytes":       {input: "25MB", want: result{size: 25 * 1000 * 1000}},
+		"mebibytes":       {input: "8 MiB", want: result{size: 8 << 20}},
+		"fractional":      {input: "1.5gb", want: result{size: 1500 * 1000 * 1000}},
+		"plain bytes":     {input: "1000", want: result{size: 1000}},
+		"unknown unit":    {input: "25XB", want: result{hasError: true}},
+		"negative number": {input: "-1MB", want: result{hasError: true}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			size, err := compiler.ParseByteSize(tc.input)
+			got := result{size: size, hasError: err != nil}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunWithPreset(t *testing.T) {
+	preset, err := compiler.LookupPreset(compiler.BuiltinPresets(), "twitter-720p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	compiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+		compiler.WithPreset(preset),
+	)
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		filepath.Join("testdata", "sample2.mp4"),
+	}
+
+	if _, err := compiler.Run(paths); err != nil {
+		t.Fatal(err)
+	}
+
+	codec, width, height := probeVideo(t, filepath.Join(outputDir, "compilation.mp4"))
+	if codec != "h264" || width != preset.Width || height != preset.Height {
+		t.Fatalf("expected h264 at %vx%v, got %v at %vx%v", preset.Width, preset.Height, codec, width, height)
+	}
+}
@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+type PreviewFormat string
+
+const (
+	PreviewGIF  PreviewFormat = "gif"
+	PreviewWebP PreviewFormat = "webp"
+)
+
+// Preview is a short, low resolution animation of the whole compilation,
+// written next to the output file as <output name>.preview.<format>.
+type Preview struct {
+	Format PreviewFormat
+	// Length of the animation in seconds. Longer compilations are sped up to fit.
+	Duration int
+	Width    int
+	FPS      int
+}
+
+func DefaultPreview(format PreviewFormat) Preview {
+	return Preview{Format: format, Duration: 10, Width: 480, FPS: 12}
+}
+
+func WithPreview(preview Preview) func(*compiler) {
+	return func(c *compiler) {
+		c.preview = &preview
+	}
+}
+
+func (c compiler) previewFileName() string {
+	name := strings.TrimSuffix(c.outputFileName, filepath.Ext(c.outputFileName))
+	return fmt.Sprintf("%v.preview.%v", name, c.preview.Format)
+}
+
+func (c compiler) writePreview() error {
+	p := c.preview
+	outputPath := filepath.Join(c.outputDir, c.outputFileName)
+	duration, err := c.probeDuration(outputPath)
+	if err != nil {
+		return fmt.Errorf("unable to measure duration of %v: %w", c.outputFileName, err)
+	}
+
+	speed := math.Max(1, duration/float64(p.Duration))
+	filter := fmt.Sprintf("setpts=PTS/%.4f,fps=%v,scale=%v:-2:flags=lanczos", speed, p.FPS, p.Width)
+
+	args := []string{"-y", "-i", outputPath, "-an", "-t", fmt.Sprint(p.Duration)}
+	switch p.Format {
+	case PreviewGIF:
+		// A palette generated from the video itself keeps the GIF from looking washed out.
+		args = append(args,
+			"-filter_complex", filter+",split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			"-loop", "0",
+		)
+	case PreviewWebP:
+		args = append(args,
+			"-vf", filter,
+			"-c:v", "libwebp", "-quality", "60", "-loop", "0",
+		)
+	default:
+		return fmt.Errorf("unsupported preview format %q", p.Format)
+	}
+
+	if err := c.ffmpeg(append(args, c.workPath(c.previewFileName()))...); err != nil {
+		return err
+	}
+	return c.publish(c.previewFileName())
+}
@@ -0,0 +1,77 @@
+package compiler_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+func TestRunOutputFormats(t *testing.T) {
+	tests := map[string]struct {
+		outputName string
+		options    []compiler.Option
+		want       []string
+	}{
+		"webm chosen by extension": {
+			outputName: "compilation.webm",
+			want:       []string{"compilation.webm"},
+		},
+		"mkv chosen by option": {
+			outputName: "compilation.mkv",
+			options:    []compiler.Option{compiler.WithContainer("mkv")},
+			want:       []string{"compilation.mkv"},
+		},
+		"gif preview": {
+			outputName: "compilation.mp4",
+			options:    []compiler.Option{compiler.WithPreview(compiler.DefaultPreview(compiler.PreviewGIF))},
+			want:       []string{"compilation.mp4", "compilation.preview.gif"},
+		},
+		"webp preview": {
+			outputName: "compilation.mp4",
+			options:    []compiler.Option{compiler.WithPreview(compiler.DefaultPreview(compiler.PreviewWebP))},
+			want:       []string{"compilation.mp4", "compilation.preview.webp"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			options := append([]compiler.Option{
+				compiler.WithOutputDir(outputDir),
+				compiler.WithOutputFileName(tc.outputName),
+				compiler.WithCleanup(false),
+			}, tc.options...)
+			paths := []string{
+				filepath.Join("testdata", "sample1.mp4"),
+				filepath.Join("testdata", "sample2.mp4"),
+			}
+
+			if _, err := compiler.New(options...).Run(paths); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			sort.Strings(got)
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected files %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("expected files %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
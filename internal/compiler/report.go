@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoClips is returned when none of the clips can be compiled.
+	ErrNoClips = errors.New("no clips left to compile")
+	// ErrClipFailed is returned in strict mode when any clip cannot be compiled.
+	ErrClipFailed = errors.New("unable to process clip")
+)
+
+// Report describes which clips made it into a compilation.
+type Report struct {
+	// Included are the clips in the compilation, in compilation order.
+	Included []Clip
+	// Skipped are the clips that were left out, in compilation order.
+	Skipped []SkippedClip
+}
+
+// SkippedClip is a clip that was left out of a compilation and the reason why.
+type SkippedClip struct {
+	Clip
+	Err error
+}
+
+func (s SkippedClip) Error() string {
+	return fmt.Sprintf("skipped clip %v: %v", s.Index+1, s.Err)
+}
+
+func (s SkippedClip) Unwrap() error {
+	return s.Err
+}
+
+// Err joins the reasons of every skipped clip, or returns nil if no clip was skipped.
+func (r Report) Err() error {
+	var errs []error
+	for _, skipped := range r.Skipped {
+		errs = append(errs, skipped)
+	}
+	return errors.Join(errs...)
+}
+
+// wrap returns err followed by the reasons of the skipped clips, if any.
+func (r Report) wrap(err error) error {
+	if skipped := r.Err(); skipped != nil {
+		return fmt.Errorf("%w: %w", err, skipped)
+	}
+	return err
+}
+
+// WithStrict makes a run fail when any clip cannot be processed. By default
+// failed clips are left out of the compilation, which only fails when no
+// clip is left.
+func WithStrict(strict bool) func(*compiler) {
+	return func(c *compiler) {
+		c.strict = strict
+	}
+}
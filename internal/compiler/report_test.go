@@ -0,0 +1,167 @@
+package compiler_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+func TestRunSkipsFailedClips(t *testing.T) {
+	outputDir := t.TempDir()
+	brokenPath := filepath.Join(t.TempDir(), "broken.mp4")
+	if err := os.WriteFile(brokenPath, []byte("not a video"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+	)
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		brokenPath,
+		filepath.Join("testdata", "sample2.mp4"),
+	}
+
+	report, err := clipCompiler.Run(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Included) != 2 || report.Included[0].Index != 0 || report.Included[1].Index != 2 {
+		t.Fatalf("expected clips 0 and 2 to be included, got %v", report.Included)
+	}
+
+	if len(report.Skipped) != 1 || report.Skipped[0].Path != brokenPath {
+		t.Fatalf("expected %v to be skipped, got %v", brokenPath, report.Skipped)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "compilation.mp4")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunWithoutSurvivingClips(t *testing.T) {
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		filepath.Join("testdata", "sample2.mp4"),
+	}
+
+	testCases := map[string]struct {
+		strict bool
+		want   error
+	}{
+		"best effort": {strict: false, want: compiler.ErrNoClips},
+		"strict":      {strict: true, want: compiler.ErrClipFailed},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			clipCompiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithCleanup(false),
+				compiler.WithNativeConcat(false),
+				compiler.WithStrict(tc.strict),
+				compiler.WithFFmpegPath(filepath.Join(outputDir, "missing-ffmpeg")),
+			)
+
+			report, err := clipCompiler.Run(paths)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+
+			if len(report.Included) != 0 || len(report.Skipped) != len(paths) {
+				t.Fatalf("expected every clip to be skipped, got %+v", report)
+			}
+		})
+	}
+}
+
+func TestRunStreamFailedClips(t *testing.T) {
+	testCases := map[string]struct {
+		strict bool
+		want   error
+	}{
+		"best effort": {strict: false},
+		"strict":      {strict: true, want: compiler.ErrClipFailed},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			clipCompiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithCleanup(false),
+				compiler.WithStrict(tc.strict),
+				compiler.WithFFmpegPath(filepath.Join(outputDir, "missing-ffmpeg")),
+			)
+
+			clips := make(chan compiler.Clip, 3)
+			clips <- compiler.Clip{Index: 0, Path: filepath.Join("testdata", "sample1.mp4")}
+			clips <- compiler.Clip{Index: 1, Err: errors.New("download failed")}
+			clips <- compiler.Clip{Index: 2, Path: filepath.Join("testdata", "sample1.mp4")}
+			close(clips)
+
+			report, err := clipCompiler.RunStream(context.Background(), clips)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+
+			if len(report.Skipped) != 1 || report.Skipped[0].Index != 1 {
+				t.Fatalf("expected clip 1 to be skipped, got %v", report.Skipped)
+			}
+
+			// A strict run fails before the compilation is published.
+			_, err = os.Stat(filepath.Join(outputDir, "compilation.mp4"))
+			if published := err == nil; published == tc.strict {
+				t.Fatalf("expected the compilation to be published: %v, got: %v", !tc.strict, published)
+			}
+		})
+	}
+}
+
+func TestRunWithoutClips(t *testing.T) {
+	for _, nativeConcat := range []bool{true, false} {
+		clipCompiler := compiler.New(
+			compiler.WithOutputDir(t.TempDir()),
+			compiler.WithNativeConcat(nativeConcat),
+		)
+
+		_, err := clipCompiler.Run(nil)
+		if !errors.Is(err, compiler.ErrNoClips) || err.Error() != compiler.ErrNoClips.Error() {
+			t.Fatalf("expected %v with native concat %v, got %v", compiler.ErrNoClips, nativeConcat, err)
+		}
+	}
+}
+
+func TestRunStreamCanceled(t *testing.T) {
+	outputDir := t.TempDir()
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+	)
+
+	clips := make(chan compiler.Clip, 2)
+	clips <- compiler.Clip{Index: 0, Path: filepath.Join("testdata", "sample1.mp4")}
+	clips <- compiler.Clip{Index: 1, Path: filepath.Join("testdata", "sample1.mp4")}
+	close(clips)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := clipCompiler.RunStream(ctx, clips); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	fileNames, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileNames) != 0 {
+		t.Fatalf("expected the output directory to be empty, got %v", fileNames)
+	}
+}
@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// SectionCards introduces every section of a compilation, such as the clips
+// of one channel, with a card showing the section's title. Cards are
+// rendered at the size and frame rate of the first clip of their section,
+// and the compilation is always re-encoded so that cards and clips join
+// cleanly.
+type SectionCards struct {
+	// Duration of each card in seconds.
+	Duration float64
+	// FontFile is the font of the titles, found the same way as
+	// Thumbnail.FontFile.
+	FontFile string
+}
+
+func DefaultSectionCards() SectionCards {
+	return SectionCards{Duration: 3}
+}
+
+func WithSectionCards(cards SectionCards) func(*compiler) {
+	return func(c *compiler) {
+		c.sectionCards = &cards
+	}
+}
+
+// insertSectionCards returns clipPaths with a card in front of the first clip
+// of every section. clips and clipPaths are in compilation order.
+func (c compiler) insertSectionCards(clips []Clip, clipPaths []string) ([]string, error) {
+	var paths []string
+	section := ""
+	for i, clip := range clips {
+		if clip.Section != "" && (i == 0 || clip.Section != section) {
+			card, err := c.writeSectionCard(clip, clipPaths[i])
+			if err != nil {
+				return nil, fmt.Errorf("unable to create section card for %v: %w", clip.Section, err)
+			}
+			paths = append(paths, card)
+		}
+		section = clip.Section
+		paths = append(paths, clipPaths[i])
+	}
+
+	return paths, nil
+}
+
+// writeSectionCard renders the card of clip's section from clipPath, so that
+// it shares the clip's dimensions, and returns the path of the card.
+func (c compiler) writeSectionCard(clip Clip, clipPath string) (string, error) {
+	titlePath := c.workPath(fmt.Sprintf("section_%03d.txt", clip.Index))
+	if err := os.WriteFile(titlePath, []byte(clip.Section), 0640); err != nil {
+		return "", err
+	}
+
+	filter := fmt.Sprintf(
+		"drawbox=color=black:t=fill,drawtext=textfile='%v':reload=0:fontcolor=white:fontsize=h/10:"+
+			"x=(w-text_w)/2:y=(h-text_h)/2",
+		escapeFilterPath(titlePath),
+	)
+	if c.sectionCards.FontFile != "" {
+		filter += fmt.Sprintf(":fontfile='%v'", escapeFilterPath(c.sectionCards.FontFile))
+	}
+
+	cardPath := c.workPath(fmt.Sprintf("section_%03d.mp4", clip.Index))
+	duration := strconv.FormatFloat(c.sectionCards.Duration, 'f', -1, 64)
+	err := c.ffmpeg(
+		"-y", "-stream_loop", "-1", "-i", clipPath,
+		"-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=48000",
+		"-map", "0:v:0", "-map", "1:a:0", "-vf", filter, "-t", duration,
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac",
+		"-video_track_timescale", "15360", cardPath,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return cardPath, nil
+}
@@ -0,0 +1,54 @@
+package compiler_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
+)
+
+func TestRunSectionCards(t *testing.T) {
+	outputDir := t.TempDir()
+	cards := compiler.SectionCards{Duration: 2}
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+		compiler.WithSectionCards(cards),
+	)
+
+	clips := make(chan compiler.Clip, 3)
+	clips <- compiler.Clip{Index: 0, Path: filepath.Join("testdata", "sample1.mp4"), Section: "streamer1"}
+	clips <- compiler.Clip{Index: 1, Path: filepath.Join("testdata", "sample2.mp4"), Section: "streamer1"}
+	clips <- compiler.Clip{Index: 2, Path: filepath.Join("testdata", "sample1.mp4"), Section: "streamer2"}
+	close(clips)
+
+	report, err := clipCompiler.RunStream(context.Background(), clips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Included) != 3 {
+		t.Fatalf("expected 3 included clips, got %v", len(report.Included))
+	}
+
+	var clipsDuration float64
+	for _, name := range []string{"sample1.mp4", "sample2.mp4", "sample1.mp4"} {
+		info, err := mp4.Probe(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clipsDuration += info.Duration.Seconds()
+	}
+
+	info, err := mp4.Probe(filepath.Join(outputDir, "compilation.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One card per section, allowing for rounding at the joins.
+	want := clipsDuration + 2*cards.Duration
+	if got := info.Duration.Seconds(); got < want-0.5 || got > want+0.5 {
+		t.Fatalf("expected a compilation of about %.1f seconds, got %.1f", want, got)
+	}
+}
@@ -0,0 +1,202 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ThumbnailMode int
+
+const (
+	// TopClip uses a representative frame of the clip with the most views.
+	// Among clips without a view count, such as files listed by path, it is
+	// the first clip.
+	TopClip ThumbnailMode = iota + 1
+	// FirstClip uses a representative frame of the first clip of the
+	// compilation. Clips fetched from twitch come most viewed first, but clips
+	// listed by URL or path keep the order they were given in.
+	FirstClip
+	// ContactSheet arranges one representative frame per clip in a grid.
+	ContactSheet
+)
+
+// Thumbnail is an image written next to the output file as
+// <output name>.thumbnail.<format>, optionally with a title rendered on it.
+type Thumbnail struct {
+	Mode ThumbnailMode
+	// Format is either "png" or "jpg".
+	Format string
+	Title  string
+	// FontFile is passed to ffmpeg's drawtext filter. If empty, the system's
+	// default font is looked up through fontconfig.
+	FontFile string
+}
+
+const (
+	contactSheetCellWidth  = 480
+	contactSheetCellHeight = 270
+	// Number of frames the thumbnail filter compares to pick a representative one.
+	thumbnailBatchSize = 100
+)
+
+func ParseThumbnailMode(s string) (ThumbnailMode, error) {
+	switch strings.ToLower(s) {
+	case "top":
+		return TopClip, nil
+	case "first":
+		return FirstClip, nil
+	case "sheet":
+		return ContactSheet, nil
+	}
+	return 0, fmt.Errorf(`thumbnail mode must be "top", "first" or "sheet", got %q`, s)
+}
+
+func ParseThumbnailFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "png":
+		return "png", nil
+	case "jpg", "jpeg":
+		return "jpg", nil
+	}
+	return "", fmt.Errorf(`thumbnail format must be "png" or "jpg", got %q`, s)
+}
+
+func WithThumbnail(thumbnail Thumbnail) func(*compiler) {
+	return func(c *compiler) {
+		c.thumbnail = &thumbnail
+	}
+}
+
+func (c compiler) thumbnailFileName() string {
+	name := strings.TrimSuffix(c.outputFileName, filepath.Ext(c.outputFileName))
+	format := c.thumbnail.Format
+	if format == "" {
+		format = "png"
+	}
+	return fmt.Sprintf("%v.thumbnail.%v", name, format)
+}
+
+// writeThumbnail creates the thumbnail from clipPaths, which are in
+// compilation order. clipPaths[i] is the file of clips[i].
+func (c compiler) writeThumbnail(clips []Clip, clipPaths []string) error {
+	if len(clipPaths) == 0 {
+		return fmt.Errorf("no clips to take a thumbnail from")
+	}
+
+	title, err := c.titleFilter()
+	if err != nil {
+		return err
+	}
+
+	if c.thumbnail.Mode == ContactSheet {
+		err = c.writeContactSheet(clipPaths, title)
+	} else {
+		path := clipPaths[0]
+		if c.thumbnail.Mode == TopClip {
+			path = clipPaths[TopClipIndex(clips)]
+		}
+		filter := fmt.Sprintf("thumbnail=%v", thumbnailBatchSize)
+		if title != "" {
+			filter += "," + title
+		}
+		err = c.ffmpeg(c.imageArgs("-i", path, "-vf", filter)...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.publish(c.thumbnailFileName())
+}
+
+// TopClipIndex returns the index of the clip with the most views, the first
+// one among clips with the same views.
+func TopClipIndex(clips []Clip) int {
+	top := 0
+	for i, clip := range clips {
+		if clip.Views > clips[top].Views {
+			top = i
+		}
+	}
+	return top
+}
+
+func (c compiler) writeContactSheet(clipPaths []string, title string) error {
+	frameDir, err := os.MkdirTemp(c.workDir, "frames-")
+	if err != nil {
+		return err
+	}
+
+	for i, path := range clipPaths {
+		framePath := filepath.Join(frameDir, fmt.Sprintf("frame_%03d.png", i))
+		err := c.ffmpeg(
+			"-y", "-i", path,
+			"-vf", fmt.Sprintf(
+				"thumbnail=%v,scale=%v:%v:force_original_aspect_ratio=decrease,pad=%v:%v:(ow-iw)/2:(oh-ih)/2,setsar=1",
+				thumbnailBatchSize, contactSheetCellWidth, contactSheetCellHeight,
+				contactSheetCellWidth, contactSheetCellHeight,
+			),
+			"-frames:v", "1", framePath,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to extract frame from %v: %w", filepath.Base(path), err)
+		}
+	}
+
+	columns := int(math.Ceil(math.Sqrt(float64(len(clipPaths)))))
+	rows := int(math.Ceil(float64(len(clipPaths)) / float64(columns)))
+	filter := fmt.Sprintf("tile=%vx%v", columns, rows)
+	if title != "" {
+		filter += "," + title
+	}
+
+	return c.ffmpeg(c.imageArgs(
+		"-framerate", "1", "-i", filepath.Join(frameDir, "frame_%03d.png"), "-vf", filter,
+	)...)
+}
+
+// imageArgs wraps the given input and filter arguments into a command that writes a single image.
+func (c compiler) imageArgs(args ...string) []string {
+	args = append([]string{"-y"}, args...)
+	args = append(args, "-frames:v", "1", "-update", "1")
+	if c.thumbnail.Format == "jpg" {
+		args = append(args, "-q:v", "2")
+	}
+	return append(args, c.workPath(c.thumbnailFileName()))
+}
+
+// titleFilter returns a drawtext filter rendering the title, or an empty string if there is none.
+// The title is read from a file so that it does not have to be escaped for the filter graph.
+func (c compiler) titleFilter() (string, error) {
+	if c.thumbnail.Title == "" {
+		return "", nil
+	}
+
+	titlePath := c.titlePath()
+	if err := os.WriteFile(titlePath, []byte(c.thumbnail.Title), 0640); err != nil {
+		return "", err
+	}
+
+	filter := fmt.Sprintf(
+		"drawtext=textfile='%v':reload=0:fontcolor=white:fontsize=h/12:"+
+			"box=1:boxcolor=black@0.6:boxborderw=20:x=(w-text_w)/2:y=h-text_h-h/12",
+		escapeFilterPath(titlePath),
+	)
+	if c.thumbnail.FontFile != "" {
+		filter += fmt.Sprintf(":fontfile='%v'", escapeFilterPath(c.thumbnail.FontFile))
+	}
+	return filter, nil
+}
+
+func (c compiler) titlePath() string {
+	return c.workPath(c.thumbnailFileName() + ".txt")
+}
+
+// escapeFilterPath escapes a path for use as a quoted filter option value.
+func escapeFilterPath(path string) string {
+	path = filepath.ToSlash(path)
+	path = strings.ReplaceAll(path, `'`, `'\''`)
+	return strings.ReplaceAll(path, ":", `\:`)
+}
@@ -0,0 +1,83 @@
+package compiler_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+)
+
+func TestRunThumbnail(t *testing.T) {
+	tests := map[string]struct {
+		thumbnail compiler.Thumbnail
+		want      string
+	}{
+		"top clip frame": {
+			thumbnail: compiler.Thumbnail{Mode: compiler.TopClip, Format: "png"},
+			want:      "compilation.thumbnail.png",
+		},
+		"first clip frame": {
+			thumbnail: compiler.Thumbnail{Mode: compiler.FirstClip, Format: "png"},
+			want:      "compilation.thumbnail.png",
+		},
+		"contact sheet with title": {
+			thumbnail: compiler.Thumbnail{Mode: compiler.ContactSheet, Format: "jpg", Title: "streamer1: best of the week"},
+			want:      "compilation.thumbnail.jpg",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			clipCompiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithCleanup(false),
+				compiler.WithThumbnail(tc.thumbnail),
+			)
+			paths := []string{
+				filepath.Join("testdata", "sample1.mp4"),
+				filepath.Join("testdata", "sample2.mp4"),
+			}
+
+			if _, err := clipCompiler.Run(paths); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(filepath.Join(outputDir, tc.want)); err != nil {
+				t.Fatalf("expected thumbnail %v to exist: %v", tc.want, err)
+			}
+
+			entries, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("expected only the compilation and its thumbnail, got %v files", len(entries))
+			}
+		})
+	}
+}
+
+func TestTopClipIndex(t *testing.T) {
+	tests := map[string]struct {
+		views []int
+		want  int
+	}{
+		"most viewed":         {views: []int{10, 30, 20}, want: 1},
+		"first of a tie":      {views: []int{10, 30, 30}, want: 1},
+		"without view counts": {views: []int{0, 0}, want: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var clips []compiler.Clip
+			for i, views := range tc.views {
+				clips = append(clips, compiler.Clip{Index: i, Views: views})
+			}
+			if got := compiler.TopClipIndex(clips); got != tc.want {
+				t.Fatalf("expected clip %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Transition blends the end of every clip into the start of the next one.
+// The compilation is always re-encoded, and it is shorter than its clips by
+// the time the transitions overlap them.
+type Transition struct {
+	// Type is the name of one of ffmpeg's xfade transitions, such as "fade"
+	// or "wipeleft". The audio is crossfaded whatever the type.
+	Type string
+	// Duration in seconds. Transitions next to clips shorter than twice the
+	// duration are shortened to half the clip.
+	Duration float64
+}
+
+const DefaultTransitionDuration = 0.5
+
+// transitionTypes are the xfade transitions that can be chosen.
+var transitionTypes = []string{
+	"fade", "fadeblack", "fadewhite", "dissolve", "distance", "pixelize", "radial",
+	"circleopen", "circleclose", "wipeleft", "wiperight", "wipeup", "wipedown",
+	"slideleft", "slideright", "slideup", "slidedown", "smoothleft", "smoothright",
+}
+
+// ParseTransitionType validates the name of a transition such as "fade" or "wipeleft".
+func ParseTransitionType(s string) (string, error) {
+	transition := strings.ToLower(strings.TrimSpace(s))
+	if !slices.Contains(transitionTypes, transition) {
+		return "", fmt.Errorf("unknown transition %q, must be one of %v", s, strings.Join(transitionTypes, ", "))
+	}
+	return transition, nil
+}
+
+func (t Transition) Validate() error {
+	if _, err := ParseTransitionType(t.Type); err != nil {
+		return err
+	}
+	if t.Duration <= 0 {
+		return fmt.Errorf("transition duration must be positive, got %v", t.Duration)
+	}
+	return nil
+}
+
+func WithTransition(transition Transition) func(*compiler) {
+	return func(c *compiler) {
+		c.transition = &transition
+	}
+}
+
+// joinsWithTransitions reports whether the final encode blends the clips
+// instead of reading them through the concat demuxer.
+func (c compiler) joinsWithTransitions(clipPaths []string) bool {
+	return c.transition != nil && len(clipPaths) > 1
+}
+
+// transitionDurations returns the length of the transition after each clip
+// but the last, given the durations of the clips.
+func (c compiler) transitionDurations(durations []float64) []float64 {
+	var overlaps []float64
+	for i := 1; i < len(durations); i++ {
+		overlaps = append(overlaps, math.Min(c.transition.Duration, math.Min(durations[i-1], durations[i])/2))
+	}
+	return overlaps
+}
+
+// transitionInput returns the input arguments and the filter graph that
+// blend clipPaths into the [joined] video and [a] audio outputs. Clips are
+// brought to the size and frame rate of the preset or else of the first
+// clip, since xfade can only blend matching streams.
+func (c compiler) transitionInput(preset Preset, clipPaths []string, durations []float64) ([]string, string, error) {
+	width, height, frameRate, err := c.probeVideo(clipPaths[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to probe %v: %w", clipPaths[0], err)
+	}
+	if preset.Width > 0 && preset.Height > 0 && c.vertical == nil {
+		width, height = preset.Width, preset.Height
+	}
+
+	var args []string
+	var graph []string
+	for i, path := range clipPaths {
+		args = append(args, "-i", path)
+		graph = append(graph,
+			fmt.Sprintf(
+				"[%[1]v:v]scale=%[2]v:%[3]v:force_original_aspect_ratio=decrease,pad=%[2]v:%[3]v:(ow-iw)/2:(oh-ih)/2,"+
+					"setsar=1,fps=%[4]v,format=yuv420p,settb=AVTB[v%[1]v]",
+				i, width, height, frameRate,
+			),
+			// Audio is cut to the length of the video, so that the two stay
+			// in sync across every transition.
+			fmt.Sprintf(
+				"[%[1]v:a]aresample=48000,aformat=sample_fmts=fltp:channel_layouts=stereo,apad,atrim=end=%[2]v[a%[1]v]",
+				i, formatSeconds(durations[i]),
+			),
+		)
+	}
+
+	videoIn, audioIn := "v0", "a0"
+	offset := durations[0]
+	for i, overlap := range c.transitionDurations(durations) {
+		offset -= overlap
+		videoOut, audioOut := fmt.Sprintf("xv%v", i+1), fmt.Sprintf("xa%v", i+1)
+		if i == len(durations)-2 {
+			videoOut, audioOut = "joined", "a"
+		}
+		graph = append(graph,
+			fmt.Sprintf("[%v][v%v]xfade=transition=%v:duration=%v:offset=%v[%v]",
+				videoIn, i+1, c.transition.Type, formatSeconds(overlap), formatSeconds(offset), videoOut),
+			fmt.Sprintf("[%v][a%v]acrossfade=d=%v[%v]", audioIn, i+1, formatSeconds(overlap), audioOut),
+		)
+		videoIn, audioIn = videoOut, audioOut
+		offset += durations[i+1]
+	}
+
+	return args, strings.Join(graph, ";"), nil
+}
+
+// probeVideo returns the dimensions and frame rate of the first video stream of the file at path.
+func (c compiler) probeVideo(path string) (int, int, string, error) {
+	cmd := exec.CommandContext(c.ctx,
+		c.ffprobePath, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height,r_frame_rate",
+		"-of", "default=noprint_wrappers=1:nokey=1", path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%v: %v", err, stderr.String())
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("unexpected ffprobe output %q", out)
+	}
+	width, errWidth := strconv.Atoi(fields[0])
+	height, errHeight := strconv.Atoi(fields[1])
+	if errWidth != nil || errHeight != nil || width <= 0 || height <= 0 {
+		return 0, 0, "", fmt.Errorf("unexpected dimensions %vx%v", fields[0], fields[1])
+	}
+	return width, height, fields[2], nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
@@ -0,0 +1,71 @@
+package compiler_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
+)
+
+func TestTransitionValidate(t *testing.T) {
+	tests := map[string]struct {
+		transition compiler.Transition
+		hasError   bool
+	}{
+		"fade":              {transition: compiler.Transition{Type: "fade", Duration: 0.5}},
+		"mixed case":        {transition: compiler.Transition{Type: "WipeLeft", Duration: 1}},
+		"unknown type":      {transition: compiler.Transition{Type: "spin", Duration: 0.5}, hasError: true},
+		"missing type":      {transition: compiler.Transition{Duration: 0.5}, hasError: true},
+		"no duration":       {transition: compiler.Transition{Type: "fade"}, hasError: true},
+		"negative duration": {transition: compiler.Transition{Type: "fade", Duration: -1}, hasError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.transition.Validate()
+			if (err != nil) != tc.hasError {
+				t.Fatalf("expected error: %v, got: %v", tc.hasError, err)
+			}
+		})
+	}
+}
+
+func TestRunTransitions(t *testing.T) {
+	outputDir := t.TempDir()
+	transition := compiler.Transition{Type: "fade", Duration: 0.5}
+	clipCompiler := compiler.New(
+		compiler.WithOutputDir(outputDir),
+		compiler.WithCleanup(false),
+		compiler.WithTransition(transition),
+	)
+	paths := []string{
+		filepath.Join("testdata", "sample1.mp4"),
+		filepath.Join("testdata", "sample2.mp4"),
+		filepath.Join("testdata", "sample1.mp4"),
+	}
+
+	if _, err := clipCompiler.Run(paths); err != nil {
+		t.Fatal(err)
+	}
+
+	var clipsDuration float64
+	for _, path := range paths {
+		info, err := mp4.Probe(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clipsDuration += info.Duration.Seconds()
+	}
+
+	info, err := mp4.Probe(filepath.Join(outputDir, "compilation.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of the two transitions overlaps the clips around it.
+	want := clipsDuration - 2*transition.Duration
+	if got := info.Duration.Seconds(); got < want-0.3 || got > want+0.3 {
+		t.Fatalf("expected a compilation of about %.1f seconds, got %.1f", want, got)
+	}
+}
@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type VerticalMode int
+
+const (
+	// BlurredBackground scales the clip to fit the frame width and fills the
+	// rest of the frame with a blurred, zoomed in copy of the clip.
+	BlurredBackground VerticalMode = iota + 1
+	// CenterCrop scales the clip to fill the frame height and crops the sides.
+	CenterCrop
+)
+
+// Rect is a region of the source video in pixels.
+type Rect struct {
+	Width  int
+	Height int
+	X      int
+	Y      int
+}
+
+// Vertical converts the compilation into a 1080x1920 video for short-form
+// platforms. If Facecam is set, that region of the source is stacked on top
+// of the gameplay.
+type Vertical struct {
+	Mode    VerticalMode
+	Facecam *Rect
+}
+
+const (
+	verticalWidth         = 1080
+	verticalHeight        = 1920
+	verticalFacecamHeight = 640
+	// Short-form platforms reject or split videos longer than a minute.
+	maxVerticalDuration = 60
+)
+
+var errInvalidRect = errors.New("region must be in width:height:x:y format")
+
+func ParseVerticalMode(s string) (VerticalMode, error) {
+	switch strings.ToLower(s) {
+	case "blur":
+		return BlurredBackground, nil
+	case "crop":
+		return CenterCrop, nil
+	}
+	return 0, fmt.Errorf(`vertical mode must be "blur" or "crop", got %q`, s)
+}
+
+// ParseRect parses a region in the width:height:x:y format used by ffmpeg's crop filter.
+func ParseRect(s string) (Rect, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return Rect{}, fmt.Errorf("%w, got %q", errInvalidRect, s)
+	}
+
+	var values [4]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 0 {
+			return Rect{}, fmt.Errorf("%w, got %q", errInvalidRect, s)
+		}
+		values[i] = v
+	}
+
+	r := Rect{Width: values[0], Height: values[1], X: values[2], Y: values[3]}
+	if r.Width == 0 || r.Height == 0 {
+		return Rect{}, fmt.Errorf("%w, got %q", errInvalidRect, s)
+	}
+	return r, nil
+}
+
+func WithVertical(vertical Vertical) func(*compiler) {
+	return func(c *compiler) {
+		c.vertical = &vertical
+	}
+}
+
+// filter returns a filter graph that reads the first input's video stream and
+// writes the vertical video to the [v] output label.
+func (v Vertical) filter() string {
+	return v.filterFrom("0:v")
+}
+
+// filterFrom is filter reading the video from the in label instead.
+func (v Vertical) filterFrom(in string) string {
+	if v.Facecam == nil {
+		return fill(in, verticalWidth, verticalHeight, v.Mode, "fill") + ";[fill]setsar=1[v]"
+	}
+
+	cam := v.Facecam
+	return fmt.Sprintf(
+		"[%v]split[cam_src][main_src];"+
+			"[cam_src]crop=%v:%v:%v:%v,scale=%v:%v:force_original_aspect_ratio=increase,crop=%v:%v[cam];",
+		in, cam.Width, cam.Height, cam.X, cam.Y,
+		verticalWidth, verticalFacecamHeight, verticalWidth, verticalFacecamHeight,
+	) + fill("main_src", verticalWidth, verticalHeight-verticalFacecamHeight, v.Mode, "main") +
+		";[cam][main]vstack,setsar=1[v]"
+}
+
+func fill(in string, width, height int, mode VerticalMode, out string) string {
+	cover := fmt.Sprintf("scale=%v:%v:force_original_aspect_ratio=increase,crop=%v:%v", width, height, width, height)
+	if mode == CenterCrop {
+		return fmt.Sprintf("[%v]%v[%v]", in, cover, out)
+	}
+
+	return fmt.Sprintf(
+		"[%v]split[%v_bg_src][%v_fg_src];"+
+			"[%v_bg_src]%v,boxblur=20:5[%v_bg];"+
+			"[%v_fg_src]scale=%v:%v:force_original_aspect_ratio=decrease:force_divisible_by=2[%v_fg];"+
+			"[%v_bg][%v_fg]overlay=(W-w)/2:(H-h)/2[%v]",
+		in, out, out,
+		out, cover, out,
+		out, width, height, out,
+		out, out, out,
+	)
+}
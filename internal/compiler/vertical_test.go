@@ -0,0 +1,95 @@
+package compiler_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
+)
+
+func TestParseRect(t *testing.T) {
+	type result struct {
+		rect     compiler.Rect
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input string
+		want  result
+	}{
+		"valid region": {
+			input: "480:270:1440:810",
+			want:  result{rect: compiler.Rect{Width: 480, Height: 270, X: 1440, Y: 810}},
+		},
+		"missing coordinates": {
+			input: "480:270",
+			want:  result{hasError: true},
+		},
+		"negative coordinate": {
+			input: "480:270:-1:0",
+			want:  result{hasError: true},
+		},
+		"zero width": {
+			input: "0:270:0:0",
+			want:  result{hasError: true},
+		},
+		"not a number": {
+			input: "480:270:a:0",
+			want:  result{hasError: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rect, err := compiler.ParseRect(tc.input)
+			got := result{rect: rect, hasError: err != nil}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunVertical(t *testing.T) {
+	tests := map[string]compiler.Vertical{
+		"blurred background": {Mode: compiler.BlurredBackground},
+		"center crop with facecam": {
+			Mode:    compiler.CenterCrop,
+			Facecam: &compiler.Rect{Width: 320, Height: 180, X: 0, Y: 0},
+		},
+	}
+
+	for name, vertical := range tests {
+		t.Run(name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			compiler := compiler.New(
+				compiler.WithOutputDir(outputDir),
+				compiler.WithCleanup(false),
+				compiler.WithVertical(vertical),
+			)
+			paths := []string{
+				filepath.Join("testdata", "sample1.mp4"),
+				filepath.Join("testdata", "sample2.mp4"),
+			}
+
+			if _, err := compiler.Run(paths); err != nil {
+				t.Fatal(err)
+			}
+
+			outputPath := filepath.Join(outputDir, "compilation.mp4")
+			if _, width, height := probeVideo(t, outputPath); width != 1080 || height != 1920 {
+				t.Fatalf("expected a 1080x1920 video, got %vx%v", width, height)
+			}
+
+			// The clips add up to more than a minute, which is cut off.
+			info, err := mp4.Probe(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Duration.Seconds(); got > 60.1 {
+				t.Fatalf("expected at most 60 seconds, got %.2f", got)
+			}
+		})
+	}
+}
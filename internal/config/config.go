@@ -0,0 +1,378 @@
+// Package config reads the clipcompiler configuration file. The file holds
+// the twitch credentials, default values for the command line options, extra
+// presets and recipes, which are sets of options for a given streamer.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+var errUnknownRecipe = errors.New("unknown recipe")
+
+type Config struct {
+	Twitch   Twitch `yaml:"twitch" toml:"twitch"`
+	Settings `yaml:",inline"`
+	// Presets are added to the builtin presets and those of the presets file.
+	Presets map[string]compiler.Preset `yaml:"presets" toml:"presets"`
+	// Recipes override Settings. A recipe named after a streamer is used
+	// whenever clips of that streamer are compiled.
+	Recipes map[string]Settings `yaml:"recipes" toml:"recipes"`
+}
+
+type Twitch struct {
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+}
+
+// Settings are default values for the command line options of the same names.
+// Settings left empty do not change the option.
+type Settings struct {
+	OutputDir       string      `yaml:"output_dir" toml:"output_dir"`
+	OutputFile      string      `yaml:"output_file" toml:"output_file"`
+	Format          string      `yaml:"format" toml:"format"`
+	Preset          string      `yaml:"preset" toml:"preset"`
+	PresetsFile     string      `yaml:"presets_file" toml:"presets_file"`
+	Max             int         `yaml:"max" toml:"max"`
+	Quality         string      `yaml:"quality" toml:"quality"`
+	MaxSize         string      `yaml:"max_size" toml:"max_size"`
+	Vertical        string      `yaml:"vertical" toml:"vertical"`
+	Facecam         string      `yaml:"facecam" toml:"facecam"`
+	Preview         string      `yaml:"preview" toml:"preview"`
+	Thumbnail       string      `yaml:"thumbnail" toml:"thumbnail"`
+	ThumbnailFormat string      `yaml:"thumbnail_format" toml:"thumbnail_format"`
+	ThumbnailTitle  string      `yaml:"thumbnail_title" toml:"thumbnail_title"`
+	Workers         int         `yaml:"workers" toml:"workers"`
+	Strict          bool        `yaml:"strict" toml:"strict"`
+	Filters         Filters     `yaml:"filters" toml:"filters"`
+	Transitions     Transitions `yaml:"transitions" toml:"transitions"`
+}
+
+// Filters leave out clips that do not meet their requirements.
+type Filters struct {
+	MinViews    int     `yaml:"min_views" toml:"min_views"`
+	MinDuration float64 `yaml:"min_duration" toml:"min_duration"`
+	MaxDuration float64 `yaml:"max_duration" toml:"max_duration"`
+}
+
+// Transitions blend every clip into the next one.
+type Transitions struct {
+	Type     string  `yaml:"type" toml:"type"`
+	Duration float64 `yaml:"duration" toml:"duration"`
+}
+
+// DefaultPath returns the location of the configuration file in the user
+// config directory, such as ~/.config/clipcompiler/config.yaml. A config.toml
+// file is used instead if it exists and config.yaml does not.
+func DefaultPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(configDir, "clipcompiler", "config.yaml")
+	tomlPath := filepath.Join(configDir, "clipcompiler", "config.toml")
+	if !exists(path) && exists(tomlPath) {
+		return tomlPath
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Load reads the configuration file at path, which is parsed as TOML if it has
+// a .toml extension and as YAML otherwise. Unknown keys are reported as
+// errors, so that typos do not go unnoticed.
+func Load(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = decodeTOML(b, &cfg)
+	} else {
+		err = decodeYAML(b, &cfg)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to parse config file %v: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+func decodeYAML(b []byte, cfg *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func decodeTOML(b []byte, cfg *Config) error {
+	md, err := toml.Decode(string(b), cfg)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return fmt.Errorf("unknown keys %v", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// Recipe returns the settings of the named recipe applied over the top level settings.
+func (c Config) Recipe(name string) (Settings, error) {
+	if name == "" {
+		return c.Settings, nil
+	}
+
+	recipe, ok := c.Recipes[name]
+	if !ok {
+		return Settings{}, fmt.Errorf("%w: %v", errUnknownRecipe, name)
+	}
+	return c.Settings.Merge(recipe), nil
+}
+
+// HasRecipe reports whether the configuration has a recipe with the given name.
+func (c Config) HasRecipe(name string) bool {
+	_, ok := c.Recipes[name]
+	return ok
+}
+
+// Merge returns s with the settings that are set in override replaced.
+func (s Settings) Merge(override Settings) Settings {
+	return Settings{
+		OutputDir:       pick(s.OutputDir, override.OutputDir),
+		OutputFile:      pick(s.OutputFile, override.OutputFile),
+		Format:          pick(s.Format, override.Format),
+		Preset:          pick(s.Preset, override.Preset),
+		PresetsFile:     pick(s.PresetsFile, override.PresetsFile),
+		Max:             pick(s.Max, override.Max),
+		Quality:         pick(s.Quality, override.Quality),
+		MaxSize:         pick(s.MaxSize, override.MaxSize),
+		Vertical:        pick(s.Vertical, override.Vertical),
+		Facecam:         pick(s.Facecam, override.Facecam),
+		Preview:         pick(s.Preview, override.Preview),
+		Thumbnail:       pick(s.Thumbnail, override.Thumbnail),
+		ThumbnailFormat: pick(s.ThumbnailFormat, override.ThumbnailFormat),
+		ThumbnailTitle:  pick(s.ThumbnailTitle, override.ThumbnailTitle),
+		Workers:         pick(s.Workers, override.Workers),
+		Strict:          pick(s.Strict, override.Strict),
+		Filters: Filters{
+			MinViews:    pick(s.Filters.MinViews, override.Filters.MinViews),
+			MinDuration: pick(s.Filters.MinDuration, override.Filters.MinDuration),
+			MaxDuration: pick(s.Filters.MaxDuration, override.Filters.MaxDuration),
+		},
+		Transitions: Transitions{
+			Type:     pick(s.Transitions.Type, override.Transitions.Type),
+			Duration: pick(s.Transitions.Duration, override.Transitions.Duration),
+		},
+	}
+}
+
+// pick returns override if it is set, or value otherwise.
+func pick[T comparable](value, override T) T {
+	var zero T
+	if override != zero {
+		return override
+	}
+	return value
+}
+
+// Flags returns the settings that are set, keyed by the name of their command line option.
+func (s Settings) Flags() map[string]string {
+	flags := map[string]string{}
+	setString := func(name, value string) {
+		if value != "" {
+			flags[name] = value
+		}
+	}
+	setNumber := func(name string, value float64) {
+		if value != 0 {
+			flags[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+
+	setString("output-dir", s.OutputDir)
+	setString("output-file", s.OutputFile)
+	setString("format", s.Format)
+	setString("preset", s.Preset)
+	setString("presets-file", s.PresetsFile)
+	setNumber("max", float64(s.Max))
+	setString("quality", s.Quality)
+	setString("max-size", s.MaxSize)
+	setString("vertical", s.Vertical)
+	setString("facecam", s.Facecam)
+	if s.Preview != "" {
+		flags["preview-"+s.Preview] = "true"
+	}
+	setString("thumbnail", s.Thumbnail)
+	setString("thumbnail-format", s.ThumbnailFormat)
+	setString("thumbnail-title", s.ThumbnailTitle)
+	setNumber("workers", float64(s.Workers))
+	if s.Strict {
+		flags["strict"] = "true"
+	}
+	setNumber("min-views", float64(s.Filters.MinViews))
+	setNumber("min-duration", s.Filters.MinDuration)
+	setNumber("max-duration", s.Filters.MaxDuration)
+	setString("transition", s.Transitions.Type)
+	setNumber("transition-duration", s.Transitions.Duration)
+
+	return flags
+}
+
+// Validate checks every setting, preset and recipe of the configuration and
+// reports all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	for _, name := range sortedKeys(c.Presets) {
+		if err := c.Presets[name].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("presets.%v: %v", name, err))
+		}
+	}
+	presetNames := c.presetNames()
+
+	if (c.Twitch.ClientID == "") != (c.Twitch.ClientSecret == "") {
+		errs = append(errs, errors.New("twitch: client_id and client_secret must be set together"))
+	}
+
+	errs = append(errs, c.Settings.validate("", presetNames)...)
+	for _, name := range sortedKeys(c.Recipes) {
+		recipe, _ := c.Recipe(name)
+		errs = append(errs, recipe.validate(fmt.Sprintf("recipes.%v.", name), presetNames)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateSettings checks settings that are used together with the
+// configuration, such as those of a scheduled job, against its presets.
+// prefix locates the settings in their file.
+func (c Config) ValidateSettings(prefix string, s Settings) error {
+	return errors.Join(s.validate(prefix, c.presetNames())...)
+}
+
+// presetNames returns the names of the builtin presets and those of the configuration.
+func (c Config) presetNames() map[string]bool {
+	names := map[string]bool{}
+	for name := range compiler.BuiltinPresets() {
+		names[name] = true
+	}
+	for name := range c.Presets {
+		names[name] = true
+	}
+	return names
+}
+
+// validate checks the settings. prefix locates them in the file.
+func (s Settings) validate(prefix string, presetNames map[string]bool) []error {
+	var errs []error
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v%v: %v", prefix, key, err))
+		}
+	}
+
+	if s.Preset != "" && !presetNames[s.Preset] {
+		// Presets from the presets file are only known once it is read,
+		// which is the default one unless the settings name another.
+		presets, err := compiler.LoadPresets(pick(compiler.DefaultPresetsPath(), s.PresetsFile))
+		if err == nil {
+			_, err = compiler.LookupPreset(presets, s.Preset)
+		}
+		check("preset", err)
+	}
+	if s.Format != "" {
+		_, err := compiler.ParseContainer(s.Format)
+		check("format", err)
+	}
+	if s.Quality != "" {
+		_, err := twitch.ParseQuality(s.Quality)
+		check("quality", err)
+	}
+	if s.MaxSize != "" {
+		_, err := compiler.ParseByteSize(s.MaxSize)
+		check("max_size", err)
+	}
+	if s.Vertical != "" {
+		_, err := compiler.ParseVerticalMode(s.Vertical)
+		check("vertical", err)
+	}
+	if s.Facecam != "" {
+		_, err := compiler.ParseRect(s.Facecam)
+		check("facecam", err)
+		if s.Vertical == "" {
+			check("facecam", errors.New("can only be used together with vertical"))
+		}
+	}
+	switch compiler.PreviewFormat(s.Preview) {
+	case "", compiler.PreviewGIF, compiler.PreviewWebP:
+	default:
+		check("preview", fmt.Errorf("unknown preview format %q", s.Preview))
+	}
+	if s.Thumbnail != "" {
+		_, err := compiler.ParseThumbnailMode(s.Thumbnail)
+		check("thumbnail", err)
+	}
+	if s.ThumbnailFormat != "" {
+		_, err := compiler.ParseThumbnailFormat(s.ThumbnailFormat)
+		check("thumbnail_format", err)
+	}
+	if s.Max < 0 {
+		check("max", errors.New("must not be negative"))
+	}
+	if s.Workers < 0 {
+		check("workers", errors.New("must not be negative"))
+	}
+
+	if s.Transitions.Type != "" {
+		_, err := compiler.ParseTransitionType(s.Transitions.Type)
+		check("transitions.type", err)
+	}
+	if s.Transitions.Duration < 0 {
+		check("transitions.duration", errors.New("must not be negative"))
+	}
+
+	f := s.Filters
+	if f.MinViews < 0 || f.MinDuration < 0 || f.MaxDuration < 0 {
+		check("filters", errors.New("values must not be negative"))
+	}
+	if f.MaxDuration > 0 && f.MinDuration > f.MaxDuration {
+		check("filters", errors.New("min_duration is greater than max_duration"))
+	}
+
+	return errs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,207 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/config"
+)
+
+func TestLoad(t *testing.T) {
+	cfg, err := config.Load(filepath.Join("testdata", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Twitch.ClientID != "abc" || cfg.Twitch.ClientSecret != "def" {
+		t.Fatalf("unexpected credentials: %+v", cfg.Twitch)
+	}
+
+	if _, ok := cfg.Presets["shorts"]; !ok {
+		t.Fatal("expected the shorts preset to be loaded")
+	}
+
+	if !cfg.HasRecipe("streamer1") || cfg.HasRecipe("streamer2") {
+		t.Fatal("expected only the streamer1 recipe")
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := config.Load(filepath.Join(t.TempDir(), "config.yaml"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	want, err := config.Load(filepath.Join("testdata", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := config.Load(filepath.Join("testdata", "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected the same config as the YAML file\nexpected: %+v\ngot: %+v", want, got)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	for _, name := range []string{"config_unknown_key.yaml", "config_unknown_key.toml"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := config.Load(filepath.Join("testdata", name))
+			if err == nil || !strings.Contains(err.Error(), "ouput_file") {
+				t.Fatalf("expected an error about the unknown key, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRecipe(t *testing.T) {
+	cfg, err := config.Load(filepath.Join("testdata", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		recipe string
+		want   map[string]string
+	}{
+		"top level settings": {
+			recipe: "",
+			want: map[string]string{
+				"output-dir": "clips",
+				"preset":     "shorts",
+				"max":        "20",
+				"min-views":  "50",
+			},
+		},
+		"recipe over top level settings": {
+			recipe: "streamer1",
+			want: map[string]string{
+				"output-dir":          "clips",
+				"preset":              "shorts",
+				"max":                 "5",
+				"vertical":            "crop",
+				"facecam":             "480:270:1440:810",
+				"preview-gif":         "true",
+				"min-views":           "50",
+				"min-duration":        "10",
+				"transition":          "fade",
+				"transition-duration": "0.75",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			settings, err := cfg.Recipe(tc.recipe)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := settings.Flags(); !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := cfg.Recipe("streamer2"); err == nil {
+		t.Fatal("expected an error for an unknown recipe")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := config.Load(filepath.Join("testdata", "config_invalid.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{
+		"presets.broken:",
+		"twitch: client_id and client_secret",
+		"quality:",
+		"transitions.type:",
+		"facecam: can only be used together with vertical",
+		"recipes.streamer1.preset:",
+		"recipes.streamer1.filters: min_duration is greater than max_duration",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateDefaultPresetsFile(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	t.Setenv("AppData", configDir)
+
+	presetsPath := compiler.DefaultPresetsPath()
+	if err := os.MkdirAll(filepath.Dir(presetsPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	presets := "mine:\n  container: mp4\n  video_codec: libx264\n  audio_codec: aac\n"
+	if err := os.WriteFile(presetsPath, []byte(presets), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{Settings: config.Settings{Preset: "mine"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected the preset of the default presets file to be found, got %v", err)
+	}
+
+	cfg = config.Config{Settings: config.Settings{Preset: "missing"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "preset:") {
+		t.Fatalf("expected an error about the unknown preset, got %v", err)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	t.Setenv("AppData", configDir)
+
+	dir := filepath.Dir(compiler.DefaultPresetsPath())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	yamlPath, tomlPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "config.toml")
+
+	if got := config.DefaultPath(); got != yamlPath {
+		t.Fatalf("expected %v without any config file, got %v", yamlPath, got)
+	}
+
+	if err := os.WriteFile(tomlPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.DefaultPath(); got != tomlPath {
+		t.Fatalf("expected %v when only it exists, got %v", tomlPath, got)
+	}
+
+	if err := os.WriteFile(yamlPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.DefaultPath(); got != yamlPath {
+		t.Fatalf("expected %v when both exist, got %v", yamlPath, got)
+	}
+}
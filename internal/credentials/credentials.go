@@ -0,0 +1,115 @@
+// Package credentials stores the twitch credentials of the CLI, together
+// with the access tokens issued for them, in a file only readable by the
+// current user.
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// ErrInsecurePermissions is returned when the credentials file can be read
+// or written by other users.
+var ErrInsecurePermissions = errors.New("credentials file is accessible by other users")
+
+const (
+	fileMode = 0600
+	dirMode  = 0700
+)
+
+type Credentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// AppToken is the last token issued for ClientID, if any.
+	AppToken twitch.AppToken `json:"app_token"`
+	// User is the account that authorized UserToken with the device code
+	// flow, if any.
+	User      *twitch.User      `json:"user,omitempty"`
+	UserToken *twitch.UserToken `json:"user_token,omitempty"`
+}
+
+// DefaultPath returns the location of the credentials file in the user
+// config directory, such as ~/.config/clipcompiler/credentials.json.
+func DefaultPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "clipcompiler", "credentials.json")
+}
+
+// Load reads the credentials file at path. Files that other users can access
+// are refused, so that a leaked secret does not go unnoticed.
+func Load(path string) (Credentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Credentials{}, err
+	}
+	// Windows does not have Unix permissions, files in the user profile are
+	// private by default.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return Credentials{}, fmt.Errorf("%w: %v has mode %v, expected %v", ErrInsecurePermissions, path, info.Mode().Perm(), os.FileMode(fileMode))
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(file).Decode(&creds); err != nil {
+		return Credentials{}, fmt.Errorf("unable to parse credentials file %v: %v", path, err)
+	}
+	return creds, nil
+}
+
+// Save writes the credentials to path, creating its directory if needed. The
+// file is replaced atomically so that an interrupted write never leaves a
+// truncated file behind.
+func Save(path string, creds Credentials) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600 already.
+	file, err := os.CreateTemp(dir, ".credentials-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(file.Name(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Remove deletes the credentials file. It is not an error if there is none.
+func Remove(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package credentials_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/credentials"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clipcompiler", "credentials.json")
+	want := credentials.Credentials{
+		ClientID:     "client_id",
+		ClientSecret: "client_secret",
+		AppToken: twitch.AppToken{
+			Value:     "token",
+			ExpiresAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	if err := credentials.Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	got, err := credentials.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ClientID != want.ClientID || got.ClientSecret != want.ClientSecret ||
+		got.AppToken.Value != want.AppToken.Value || !got.AppToken.ExpiresAt.Equal(want.AppToken.ExpiresAt) {
+		t.Fatalf("expected: %+v, got: %+v", want, got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the credentials file, got %v", entries)
+	}
+}
+
+func TestLoadInsecurePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte(`{"client_id": "client_id"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := credentials.Load(path)
+	if !errors.Is(err, credentials.ErrInsecurePermissions) {
+		t.Fatalf("expected %v, got %v", credentials.ErrInsecurePermissions, err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := credentials.Save(path, credentials.Credentials{ClientID: "client_id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := credentials.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := credentials.Load(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+	}
+
+	// Logging out twice is fine.
+	if err := credentials.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,62 +1,136 @@
 package downloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
 var ErrCreateOutputDir = errors.New("failed to create output directory")
 
+// Download is a file to fetch. Name is the file name it is saved under.
+type Download struct {
+	Name string
+	URL  string
+}
+
+// Result is the outcome of a single download. Index is the position of the
+// download in the list passed to Stream.
+type Result struct {
+	Index int
+	Path  string
+	Err   error
+}
+
 func Run(outputPath string, urls []string) ([]string, error) {
+	results, err := Stream(context.Background(), outputPath, NamedByURL(urls))
+	if err != nil {
+		return nil, err
+	}
+
+	// Downloads finish in any order, so results are collected by index to
+	// keep the clips in the order they were requested.
+	errs := make([]error, len(urls))
+	paths := make([]string, len(urls))
+	for result := range results {
+		paths[result.Index] = result.Path
+		errs[result.Index] = result.Err
+	}
+
+	var downloaded []string
+	for _, path := range paths {
+		if path != "" {
+			downloaded = append(downloaded, path)
+		}
+	}
+	return downloaded, errors.Join(errs...)
+}
+
+// Stream downloads every file concurrently and sends each result as soon as
+// its download finishes. The channel is closed once all downloads are done.
+// Downloads sharing a name are given a numeric suffix instead of overwriting
+// each other. Canceling ctx aborts the downloads that are still running.
+func Stream(ctx context.Context, outputPath string, downloads []Download) (<-chan Result, error) {
 	err := os.MkdirAll(outputPath, 0750)
 	if err != nil {
 		return nil, errors.Join(ErrCreateOutputDir, err)
 	}
 
 	var wg sync.WaitGroup
-	errs := make(chan error, len(urls))
-	paths := make(chan string, len(urls))
-	for _, url := range urls {
-		path := filepath.Join(outputPath, path.Base(url))
-		url := url
+	results := make(chan Result, len(downloads))
+	names := uniqueNames(downloads)
+	for i, d := range downloads {
+		i := i
+		url := d.URL
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err = download(path, url)
-			if err != nil {
-				errs <- err
+			path := filepath.Join(outputPath, names[i])
+			if err := download(ctx, path, url); err != nil {
+				results <- Result{Index: i, Err: err}
 			} else {
-				paths <- path
+				results <- Result{Index: i, Path: path}
 			}
 		}()
 	}
 
 	go func() {
 		wg.Wait()
-		close(errs)
-		close(paths)
+		close(results)
 	}()
 
-	var joinedErrors error
-	for err := range errs {
-		joinedErrors = errors.Join(joinedErrors, err)
+	return results, nil
+}
+
+// NamedByURL names each download after the last segment of its URL path.
+func NamedByURL(urls []string) []Download {
+	downloads := make([]Download, len(urls))
+	for i, rawURL := range urls {
+		name := path.Base(rawURL)
+		if u, err := url.Parse(rawURL); err == nil {
+			name = path.Base(u.Path)
+		}
+		downloads[i] = Download{Name: name, URL: rawURL}
 	}
 
-	var downloaded []string
-	for path := range paths {
-		downloaded = append(downloaded, path)
+	return downloads
+}
+
+// uniqueNames returns the file name of each download. Signed URLs often share
+// their last segment (e.g. "1080.mp4"), so duplicates get a numeric suffix.
+func uniqueNames(downloads []Download) []string {
+	names := make([]string, len(downloads))
+	used := map[string]bool{}
+	for i, d := range downloads {
+		name := filepath.Base(d.Name)
+		// A suffixed name can itself be the name of a later download, so
+		// suffixes are tried until the name is free.
+		ext := filepath.Ext(name)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%v-%v%v", strings.TrimSuffix(filepath.Base(d.Name), ext), n, ext)
+		}
+		used[name] = true
+		names[i] = name
 	}
-	return downloaded, joinedErrors
+
+	return names
 }
 
-func download(path, url string) error {
-	res, err := http.Get(url)
+func download(ctx context.Context, path, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -74,17 +148,22 @@ func download(path, url string) error {
 		return fmt.Errorf("unable to download clip: %v %v", res.StatusCode, errMsg)
 	}
 
-	file, err := os.Create(path)
+	// The clip is written under a temporary name first so that an interrupted
+	// download never leaves a truncated file behind under the final name.
+	partPath := path + ".part"
+	file, err := os.Create(partPath)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
-
 	_, err = io.Copy(file, res.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(partPath)
 		return err
 	}
 
-	return nil
+	return os.Rename(partPath, path)
 }
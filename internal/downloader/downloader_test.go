@@ -1,13 +1,17 @@
 package downloader_test
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/downloader"
 )
@@ -82,3 +86,166 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunPreservesOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Make earlier clips finish last.
+		if path.Base(r.URL.Path) == "example1.mp4" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte("clip data"))
+	}))
+	defer server.Close()
+
+	var urls []string
+	var want []string
+	for _, name := range []string{"example1.mp4", "example2.mp4", "example3.mp4"} {
+		clipURL, _ := url.JoinPath(server.URL, name)
+		urls = append(urls, clipURL)
+		want = append(want, name)
+	}
+
+	downloaded, err := downloader.Run(t.TempDir(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, path := range downloaded {
+		got = append(got, filepath.Base(path))
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestRunDuplicateFileNames(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	urls := []string{
+		server.URL + "/clip1/1080.mp4?sig=abc&token=def",
+		server.URL + "/clip2/1080.mp4?sig=ghi&token=jkl",
+	}
+
+	downloaded, err := downloader.Run(t.TempDir(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"1080.mp4", "1080-2.mp4"}
+	var got []string
+	for _, path := range downloaded {
+		got = append(got, filepath.Base(path))
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestStreamNamedDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.mp4" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	downloads := []downloader.Download{
+		{Name: "ClipA.mp4", URL: server.URL + "/1080.mp4"},
+		{Name: "ClipB.mp4", URL: server.URL + "/1080.mp4"},
+		{Name: "ClipB.mp4", URL: server.URL + "/720.mp4"},
+		{Name: "ClipC.mp4", URL: server.URL + "/broken.mp4"},
+	}
+
+	outputPath := t.TempDir()
+	results, err := downloader.Stream(context.Background(), outputPath, downloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[int]string{}
+	for result := range results {
+		if result.Err != nil {
+			got[result.Index] = "error"
+			continue
+		}
+		got[result.Index] = filepath.Base(result.Path)
+	}
+
+	want := map[int]string{0: "ClipA.mp4", 1: "ClipB.mp4", 2: "ClipB-2.mp4", 3: "error"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	// Failed downloads must not leave partial files behind.
+	entries, err := os.ReadDir(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 files in the output directory, got %v", len(entries))
+	}
+}
+
+func TestStreamSuffixCollisions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	tests := map[string]struct {
+		names []string
+		want  []string
+	}{
+		"suffixed name listed after its duplicates": {
+			names: []string{"a.mp4", "a.mp4", "a-2.mp4"},
+			want:  []string{"a.mp4", "a-2.mp4", "a-2-2.mp4"},
+		},
+		"suffixed name listed before its duplicates": {
+			names: []string{"a.mp4", "a-2.mp4", "a.mp4"},
+			want:  []string{"a.mp4", "a-2.mp4", "a-3.mp4"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var downloads []downloader.Download
+			for i, name := range tc.names {
+				downloads = append(downloads, downloader.Download{Name: name, URL: fmt.Sprintf("%v/%v", server.URL, i)})
+			}
+
+			outputPath := t.TempDir()
+			results, err := downloader.Stream(context.Background(), outputPath, downloads)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(downloads))
+			for result := range results {
+				if result.Err != nil {
+					t.Fatal(result.Err)
+				}
+				got[result.Index] = filepath.Base(result.Path)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+
+			// Every download is kept in a file of its own.
+			entries, err := os.ReadDir(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(downloads) {
+				t.Fatalf("expected %v files in the output directory, got %v", len(downloads), len(entries))
+			}
+		})
+	}
+}
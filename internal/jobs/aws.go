@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// usageKeyPrefix sets the usage counters kept by DynamoStore apart from
+// jobs, whose IDs never contain "#".
+const usageKeyPrefix = "usage#"
+
+// DynamoStore keeps jobs in a DynamoDB table keyed by id, together with the
+// usage counters, which expire through the table's TTL on expires_at.
+type DynamoStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewDynamoStore(client *dynamodb.Client, tableName string) DynamoStore {
+	return DynamoStore{client: client, tableName: tableName}
+}
+
+func (s DynamoStore) Put(ctx context.Context, item Item) error {
+	mapItem, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:      mapItem,
+		TableName: &s.tableName,
+	})
+	return err
+}
+
+func (s DynamoStore) Get(ctx context.Context, id string) (Item, error) {
+	if strings.HasPrefix(id, usageKeyPrefix) {
+		return Item{}, ErrNotFound
+	}
+
+	// Clients poll right after creating a job, before an eventually
+	// consistent read would see it.
+	consistentRead := true
+	output, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+		TableName:      &s.tableName,
+		ConsistentRead: &consistentRead,
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	if output.Item == nil {
+		return Item{}, ErrNotFound
+	}
+
+	var item Item
+	if err := attributevalue.UnmarshalMap(output.Item, &item); err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+func (s DynamoStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	// The counter is created on its first increment.
+	update := "ADD #count :one SET expires_at = :expires_at"
+	output, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:              map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: usageKeyPrefix + key}},
+		TableName:        &s.tableName,
+		UpdateExpression: &update,
+		ExpressionAttributeNames: map[string]string{
+			"#count": "count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+			":expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var usage struct {
+		Count int `dynamodbav:"count"`
+	}
+	if err := attributevalue.UnmarshalMap(output.Attributes, &usage); err != nil {
+		return 0, err
+	}
+	return usage.Count, nil
+}
+
+func (s DynamoStore) Decrement(ctx context.Context, key string) error {
+	// A counter that is missing or already at zero is left alone.
+	update := "ADD #count :minus_one"
+	condition := "#count > :zero"
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: usageKeyPrefix + key}},
+		TableName:           &s.tableName,
+		UpdateExpression:    &update,
+		ConditionExpression: &condition,
+		ExpressionAttributeNames: map[string]string{
+			"#count": "count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":minus_one": &types.AttributeValueMemberN{Value: "-1"},
+			":zero":      &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil
+	}
+	return err
+}
+
+// S3BlobStore uploads compilations to an S3 bucket and hands out presigned
+// URLs that are valid for an hour.
+type S3BlobStore struct {
+	client     *s3.Client
+	bucketName string
+}
+
+func NewS3BlobStore(client *s3.Client, bucketName string) S3BlobStore {
+	return S3BlobStore{client: client, bucketName: bucketName}
+}
+
+func (s S3BlobStore) Put(ctx context.Context, key, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	uploader := manager.NewUploader(s.client)
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: &s.bucketName,
+		Key:    &key,
+		Body:   file,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	presignClient := s3.NewPresignClient(s.client)
+	presignedUrl, err := presignClient.PresignGetObject(ctx,
+		&s3.GetObjectInput{
+			Bucket: &s.bucketName,
+			Key:    &key,
+		},
+		s3.WithPresignExpires(time.Hour*1),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return presignedUrl.URL, nil
+}
+
+// SQSQueue sends requests to an SQS queue looked up by name.
+type SQSQueue struct {
+	client *sqs.Client
+	name   string
+}
+
+func NewSQSQueue(client *sqs.Client, name string) SQSQueue {
+	return SQSQueue{client: client, name: name}
+}
+
+func (q SQSQueue) Send(ctx context.Context, body string) error {
+	output, err := q.client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: &q.name,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    output.QueueUrl,
+		MessageBody: &body,
+	})
+	return err
+}
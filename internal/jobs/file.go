@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore keeps every job in a JSON file named after the job.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) FileStore {
+	return FileStore{dir: dir}
+}
+
+func (s FileStore) Put(ctx context.Context, item Item) error {
+	path, err := safeJoin(s.dir, item.ID+".json")
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+func (s FileStore) Get(ctx context.Context, id string) (Item, error) {
+	path, err := safeJoin(s.dir, id+".json")
+	if err != nil {
+		return Item{}, ErrNotFound
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Item{}, ErrNotFound
+	}
+	if err != nil {
+		return Item{}, err
+	}
+
+	var item Item
+	if err := json.Unmarshal(b, &item); err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// List returns every job in the store.
+func (s FileStore) List(ctx context.Context) ([]Item, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for _, path := range paths {
+		item, err := s.Get(ctx, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read %v: %w", path, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// FileBlobStore copies compilations into a directory served under baseURL.
+type FileBlobStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewFileBlobStore(dir, baseURL string) FileBlobStore {
+	return FileBlobStore{dir: dir, baseURL: baseURL}
+}
+
+func (s FileBlobStore) Put(ctx context.Context, key, path string) (string, error) {
+	dest, err := safeJoin(s.dir, key)
+	if err != nil {
+		return "", err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	err = writeFileAtomic(dest, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.baseURL + url.PathEscape(key), nil
+}
+
+// safeJoin joins dir and name, refusing names that would leave dir. Job IDs
+// and file names include the username of the request.
+func safeJoin(dir, name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// writeFileAtomic writes a file next to path and renames it into place, so
+// that readers never see a partial file.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
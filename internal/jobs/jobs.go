@@ -0,0 +1,99 @@
+// Package jobs describes the compilation jobs of the web API, which are
+// created by the API and carried out by the processor, and the stores and
+// queue they are passed through. Each has an AWS implementation used on
+// Lambda and a local one used by clipserver and in tests.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by job stores for jobs they have no record of.
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned by queues that cannot take any more requests.
+	ErrQueueFull = errors.New("too many requests are waiting to be processed, try again later")
+)
+
+// Status is the stage a job is at. The values of done and failed predate
+// the other states and are kept for the items already stored.
+type Status int
+
+const (
+	StatusDone Status = iota
+	StatusFailed
+	StatusQueued
+	StatusProcessing
+)
+
+var statusNames = map[Status]string{
+	StatusDone:       "done",
+	StatusFailed:     "failed",
+	StatusQueued:     "queued",
+	StatusProcessing: "processing",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	name, ok := statusNames[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown job status %d", int(s))
+	}
+	return []byte(name), nil
+}
+
+func (s *Status) UnmarshalText(text []byte) error {
+	for status, name := range statusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown job status %q", text)
+}
+
+// Item is the record of a job. URL is set once the job is done and ErrorMsg
+// once it has failed.
+type Item struct {
+	ID       string  `dynamodbav:"id" json:"id"`
+	URL      *string `dynamodbav:"url" json:"url"`
+	Status   Status  `dynamodbav:"status" json:"status"`
+	ErrorMsg *string `dynamodbav:"error_msg" json:"error_msg"`
+}
+
+// JobStore keeps the records of jobs.
+type JobStore interface {
+	Put(ctx context.Context, item Item) error
+	// Get returns the record of the job with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (Item, error)
+}
+
+// UsageStore counts the requests of clients.
+type UsageStore interface {
+	// Increment adds one to the counter named key and returns its new
+	// value. The counter may be dropped once expiresAt has passed.
+	Increment(ctx context.Context, key string, expiresAt time.Time) (int, error)
+	// Decrement takes back an increment of the counter named key, for a
+	// request that ended up not being served. Counters never go below zero.
+	Decrement(ctx context.Context, key string) error
+}
+
+// BlobStore makes finished compilations available for download.
+type BlobStore interface {
+	// Put stores the file at path under key and returns a URL to download it from.
+	Put(ctx context.Context, key, path string) (string, error)
+}
+
+// Queue hands job requests from the API over to the processor.
+type Queue interface {
+	Send(ctx context.Context, body string) error
+}
@@ -0,0 +1,51 @@
+package jobs_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+func TestStatusJSON(t *testing.T) {
+	tests := map[string]struct {
+		status jobs.Status
+		want   string
+	}{
+		"done":       {status: jobs.StatusDone, want: `"done"`},
+		"failed":     {status: jobs.StatusFailed, want: `"failed"`},
+		"queued":     {status: jobs.StatusQueued, want: `"queued"`},
+		"processing": {status: jobs.StatusProcessing, want: `"processing"`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(tc.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.want {
+				t.Fatalf("expected %v, got %s", tc.want, b)
+			}
+
+			var got jobs.Status
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.status {
+				t.Fatalf("expected %v, got %v", tc.status, got)
+			}
+		})
+	}
+}
+
+func TestStatusJSONUnknown(t *testing.T) {
+	if _, err := json.Marshal(jobs.Status(42)); err == nil {
+		t.Fatal("expected an error for an unknown status")
+	}
+
+	var status jobs.Status
+	if err := json.Unmarshal([]byte(`"paused"`), &status); err == nil {
+		t.Fatal("expected an error for an unknown status")
+	}
+}
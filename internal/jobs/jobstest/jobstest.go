@@ -0,0 +1,36 @@
+// Package jobstest provides job stores for tests.
+package jobstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+// RecordingStore is a jobs.JobStore that keeps every item put, in order, on
+// top of storing it in JobStore.
+type RecordingStore struct {
+	jobs.JobStore
+	mu   sync.Mutex
+	puts []jobs.Item
+}
+
+// NewRecordingStore returns a RecordingStore backed by a jobs.MemoryStore.
+func NewRecordingStore() *RecordingStore {
+	return &RecordingStore{JobStore: jobs.NewMemoryStore()}
+}
+
+func (s *RecordingStore) Put(ctx context.Context, item jobs.Item) error {
+	s.mu.Lock()
+	s.puts = append(s.puts, item)
+	s.mu.Unlock()
+	return s.JobStore.Put(ctx, item)
+}
+
+// Puts returns the items put so far, oldest first.
+func (s *RecordingStore) Puts() []jobs.Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]jobs.Item{}, s.puts...)
+}
@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs and usage counters in memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	items    map[string]Item
+	counters map[string]counter
+}
+
+type counter struct {
+	count     int
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]Item{}, counters: map[string]counter{}}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = item
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	return item, nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || now.After(c.expiresAt) {
+		// Counters are named after their window of time, so a new one
+		// usually means the previous windows are over.
+		for key, c := range s.counters {
+			if now.After(c.expiresAt) {
+				delete(s.counters, key)
+			}
+		}
+		c = counter{}
+	}
+
+	c.count++
+	c.expiresAt = expiresAt
+	s.counters[key] = c
+	return c.count, nil
+}
+
+func (s *MemoryStore) Decrement(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.counters[key]; ok && c.count > 0 {
+		c.count--
+		s.counters[key] = c
+	}
+	return nil
+}
+
+// MemoryQueue passes requests to a processor in the same process.
+type MemoryQueue struct {
+	messages chan string
+}
+
+// NewMemoryQueue returns a queue that holds up to size requests.
+func NewMemoryQueue(size int) *MemoryQueue {
+	return &MemoryQueue{messages: make(chan string, size)}
+}
+
+// Send queues body, or fails with ErrQueueFull right away when the queue is
+// full, so that a request never hangs while the processor is busy.
+func (q *MemoryQueue) Send(ctx context.Context, body string) error {
+	select {
+	case q.messages <- body:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Messages returns the channel requests are received from.
+func (q *MemoryQueue) Messages() <-chan string {
+	return q.messages
+}
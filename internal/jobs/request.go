@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request is a compilation of the most viewed clips of a streamer, created
+// between two dates, inclusive.
+type Request struct {
+	Username string `json:"username"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Count    int    `json:"count"`
+}
+
+// Limits bounds the requests the API accepts and the processor carries out.
+type Limits struct {
+	// MaxCount is the most clips a compilation can have.
+	MaxCount int
+	// MaxRangeDays is the most days a request can span, counting both the start and end date.
+	MaxRangeDays int
+}
+
+func DefaultLimits() Limits {
+	return Limits{MaxCount: 10, MaxRangeDays: 31}
+}
+
+// LimitsFromEnv returns the default limits, overridden by MAX_CLIP_COUNT and
+// MAX_RANGE_DAYS when they are set.
+func LimitsFromEnv() (Limits, error) {
+	limits := DefaultLimits()
+	for name, limit := range map[string]*int{
+		"MAX_CLIP_COUNT": &limits.MaxCount,
+		"MAX_RANGE_DAYS": &limits.MaxRangeDays,
+	} {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return Limits{}, fmt.Errorf("%v must be a positive number, got %q", name, value)
+		}
+		*limit = n
+	}
+	return limits, nil
+}
+
+// FieldError describes what is wrong with a field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid request: ")
+	for i, fieldErr := range e {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%v %v", fieldErr.Field, fieldErr.Message)
+	}
+	return b.String()
+}
+
+// Twitch logins are made of letters, digits and underscores.
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,25}$`)
+
+// Validate checks r against limits and returns a ValidationError listing
+// every invalid field, or nil.
+func (r Request) Validate(limits Limits) error {
+	var errs ValidationError
+	if r.Username == "" {
+		errs = append(errs, FieldError{Field: "username", Message: "is required"})
+	} else if !usernamePattern.MatchString(r.Username) {
+		errs = append(errs, FieldError{Field: "username", Message: "must be 1 to 25 letters, digits or underscores"})
+	}
+
+	start, startErr := parseDate("start", r.Start)
+	if startErr != nil {
+		errs = append(errs, *startErr)
+	}
+	end, endErr := parseDate("end", r.End)
+	if endErr != nil {
+		errs = append(errs, *endErr)
+	}
+	if startErr == nil && endErr == nil {
+		days := int(end.Sub(start)/(24*time.Hour)) + 1
+		if end.Before(start) {
+			errs = append(errs, FieldError{Field: "end", Message: "must not be before start"})
+		} else if days > limits.MaxRangeDays {
+			errs = append(errs, FieldError{
+				Field:   "end",
+				Message: fmt.Sprintf("must be at most %v days from start, counting both dates", limits.MaxRangeDays),
+			})
+		}
+	}
+
+	if r.Count < 1 || r.Count > limits.MaxCount {
+		errs = append(errs, FieldError{Field: "count", Message: fmt.Sprintf("must be between 1 and %v", limits.MaxCount)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func parseDate(field, value string) (time.Time, *FieldError) {
+	if value == "" {
+		return time.Time{}, &FieldError{Field: field, Message: "is required"}
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, &FieldError{Field: field, Message: "must be a date in the format YYYY-MM-DD"}
+	}
+	return date, nil
+}
@@ -0,0 +1,135 @@
+package jobs_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+func TestRequestValidate(t *testing.T) {
+	limits := jobs.Limits{MaxCount: 10, MaxRangeDays: 7}
+	valid := jobs.Request{Username: "streamer_1", Start: "2023-01-01", End: "2023-01-07", Count: 10}
+
+	tests := map[string]struct {
+		modify func(r *jobs.Request)
+		want   jobs.ValidationError
+	}{
+		"valid": {
+			modify: func(r *jobs.Request) {},
+		},
+		"single day": {
+			modify: func(r *jobs.Request) { r.End = r.Start },
+		},
+		"missing fields": {
+			modify: func(r *jobs.Request) { *r = jobs.Request{} },
+			want: jobs.ValidationError{
+				{Field: "username", Message: "is required"},
+				{Field: "start", Message: "is required"},
+				{Field: "end", Message: "is required"},
+				{Field: "count", Message: "must be between 1 and 10"},
+			},
+		},
+		"invalid username": {
+			modify: func(r *jobs.Request) { r.Username = "../streamer1" },
+			want:   jobs.ValidationError{{Field: "username", Message: "must be 1 to 25 letters, digits or underscores"}},
+		},
+		"long username": {
+			modify: func(r *jobs.Request) { r.Username = "abcdefghijklmnopqrstuvwxyz" },
+			want:   jobs.ValidationError{{Field: "username", Message: "must be 1 to 25 letters, digits or underscores"}},
+		},
+		"invalid dates": {
+			modify: func(r *jobs.Request) { r.Start = "01/01/2023"; r.End = "2023-02-30" },
+			want: jobs.ValidationError{
+				{Field: "start", Message: "must be a date in the format YYYY-MM-DD"},
+				{Field: "end", Message: "must be a date in the format YYYY-MM-DD"},
+			},
+		},
+		"end before start": {
+			modify: func(r *jobs.Request) { r.End = "2022-12-31" },
+			want:   jobs.ValidationError{{Field: "end", Message: "must not be before start"}},
+		},
+		"range too long": {
+			modify: func(r *jobs.Request) { r.End = "2023-01-08" },
+			want:   jobs.ValidationError{{Field: "end", Message: "must be at most 7 days from start, counting both dates"}},
+		},
+		"count too high": {
+			modify: func(r *jobs.Request) { r.Count = 11 },
+			want:   jobs.ValidationError{{Field: "count", Message: "must be between 1 and 10"}},
+		},
+		"negative count": {
+			modify: func(r *jobs.Request) { r.Count = -1 },
+			want:   jobs.ValidationError{{Field: "count", Message: "must be between 1 and 10"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := valid
+			tc.modify(&req)
+
+			err := req.Validate(limits)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var got jobs.ValidationError
+			if !errors.As(err, &got) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		want    jobs.Limits
+		wantErr bool
+	}{
+		"defaults": {
+			want: jobs.DefaultLimits(),
+		},
+		"overridden": {
+			env:  map[string]string{"MAX_CLIP_COUNT": "20", "MAX_RANGE_DAYS": "14"},
+			want: jobs.Limits{MaxCount: 20, MaxRangeDays: 14},
+		},
+		"not a number": {
+			env:     map[string]string{"MAX_CLIP_COUNT": "many"},
+			wantErr: true,
+		},
+		"zero": {
+			env:     map[string]string{"MAX_RANGE_DAYS": "0"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			got, err := jobs.LimitsFromEnv()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
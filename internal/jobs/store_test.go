@@ -0,0 +1,190 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+func TestJobStores(t *testing.T) {
+	tests := map[string]struct {
+		newStore func(t *testing.T) jobs.JobStore
+	}{
+		"memory": {
+			newStore: func(t *testing.T) jobs.JobStore { return jobs.NewMemoryStore() },
+		},
+		"file": {
+			newStore: func(t *testing.T) jobs.JobStore { return jobs.NewFileStore(t.TempDir()) },
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tc.newStore(t)
+
+			if _, err := store.Get(ctx, "streamer1-123"); !errors.Is(err, jobs.ErrNotFound) {
+				t.Fatalf("expected %v, got %v", jobs.ErrNotFound, err)
+			}
+
+			if err := store.Put(ctx, jobs.Item{ID: "streamer1-123", Status: jobs.StatusQueued}); err != nil {
+				t.Fatal(err)
+			}
+			url := "https://example.com/streamer1-123.mp4"
+			if err := store.Put(ctx, jobs.Item{ID: "streamer1-123", Status: jobs.StatusDone, URL: &url}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Get(ctx, "streamer1-123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != "streamer1-123" || got.Status != jobs.StatusDone || got.URL == nil || *got.URL != url || got.ErrorMsg != nil {
+				t.Fatalf("expected the last item put, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestFileStoreRejectsPaths(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewFileStore(t.TempDir())
+
+	if err := store.Put(ctx, jobs.Item{ID: "../streamer1"}); err == nil {
+		t.Fatal("expected an error for an ID outside of the store")
+	}
+	if _, err := store.Get(ctx, "../streamer1"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", jobs.ErrNotFound, err)
+	}
+}
+
+func TestFileStoreList(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewFileStore(t.TempDir())
+
+	items, err := store.List(ctx)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected no items, got %v and %v", items, err)
+	}
+
+	for _, id := range []string{"streamer1-123", "streamer2-456"} {
+		if err := store.Put(ctx, jobs.Item{ID: id, Status: jobs.StatusQueued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err = store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ID != "streamer1-123" || items[1].ID != "streamer2-456" {
+		t.Fatalf("expected both items, got %+v", items)
+	}
+}
+
+func TestFileBlobStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "compilation.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := jobs.NewFileBlobStore(dir, "http://localhost:8080/files/")
+	url, err := blobs.Put(ctx, "streamer 1.mp4", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://localhost:8080/files/streamer%201.mp4"; url != want {
+		t.Fatalf("expected URL %v, got %v", want, url)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "streamer 1.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "video" {
+		t.Fatalf("expected the file to be copied, got %q", b)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected the source file to be kept, got %v", err)
+	}
+
+	if _, err := blobs.Put(ctx, "../escape.mp4", src); err == nil {
+		t.Fatal("expected an error for a key outside of the store")
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	queue := jobs.NewMemoryQueue(1)
+
+	if err := queue.Send(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Send(ctx, "second"); !errors.Is(err, jobs.ErrQueueFull) {
+		t.Fatalf("expected %v, got %v", jobs.ErrQueueFull, err)
+	}
+
+	if got := <-queue.Messages(); got != "first" {
+		t.Fatalf("expected the first message, got %q", got)
+	}
+	if err := queue.Send(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStoreIncrement(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	later := time.Now().Add(time.Minute)
+
+	for want := 1; want <= 3; want++ {
+		got, err := store.Increment(ctx, "ip#127.0.0.1", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected count %v, got %v", want, got)
+		}
+	}
+
+	if got, _ := store.Increment(ctx, "ip#127.0.0.2", later); got != 1 {
+		t.Fatalf("expected counters to be separate, got %v", got)
+	}
+
+	// A counter past its expiry starts over.
+	past := time.Now().Add(-time.Second)
+	store.Increment(ctx, "ip#127.0.0.3", past)
+	if got, _ := store.Increment(ctx, "ip#127.0.0.3", later); got != 1 {
+		t.Fatalf("expected the expired counter to start over, got %v", got)
+	}
+}
+
+func TestMemoryStoreDecrement(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	later := time.Now().Add(time.Minute)
+
+	store.Increment(ctx, "ip#127.0.0.1", later)
+	store.Increment(ctx, "ip#127.0.0.1", later)
+	if err := store.Decrement(ctx, "ip#127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Increment(ctx, "ip#127.0.0.1", later); got != 2 {
+		t.Fatalf("expected count 2 after giving one back, got %v", got)
+	}
+
+	// Counters never go below zero, and missing ones are left alone.
+	if err := store.Decrement(ctx, "ip#127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Increment(ctx, "ip#127.0.0.2", later); got != 1 {
+		t.Fatalf("expected a missing counter to start at 1, got %v", got)
+	}
+}
@@ -3,27 +3,29 @@ package lambdaapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/apigateway"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
 )
 
-type request struct {
-	Username string `json:"username"`
-	Start    string `json:"start"`
-	End      string `json:"end"`
-	Count    int    `json:"count"`
-}
+// queueFullRetryAfter is the number of seconds clients are asked to wait
+// when too many requests are waiting to be processed.
+const queueFullRetryAfter = 60
 
 type message struct {
-	request
+	jobs.Request
 	ID     string `json:"id"`
 	UserID string `json:"user_id"`
 }
@@ -32,86 +34,209 @@ type response struct {
 	ID string `json:"id"`
 }
 
+type statusResponse struct {
+	ID     string      `json:"id"`
+	Status jobs.Status `json:"status"`
+	URL    string      `json:"url,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// NewHandler returns the handler of the Lambda function, which keeps jobs in
+// the DynamoDB table named by DYNAMODB_TABLE_NAME and sends requests to the
+// SQS queue named by SQS_QUEUE_NAME. Requests are checked against the limits
+// set by MAX_CLIP_COUNT and MAX_RANGE_DAYS, and clients are rate limited in
+// the same table as set by RateLimitsFromEnv.
 func NewHandler() func(ctx context.Context, event *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
 	return func(ctx context.Context, event *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
-		var req request
-		err := json.Unmarshal([]byte(event.Body), &req)
-		if err != nil {
-			return apigateway.NewResponse(
-				http.StatusBadRequest, apigateway.NewErrorJSONString(err),
-			), nil
-		}
-
-		clientId := os.Getenv("TWITCH_CLIENT_ID")
-		clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
-		authBaseURL := os.Getenv("TWITCH_AUTH_BASE_URL")
-		apiBaseURL := os.Getenv("TWITCH_API_BASE_URL")
-
-		twitchSvc, err := twitch.NewService(clientId, clientSecret, authBaseURL, apiBaseURL)
+		cfg, err := config.LoadDefaultConfig(ctx)
 		if err != nil {
-			err = fmt.Errorf("unable to initialize twitch service: %w", err)
 			return apigateway.NewResponse(
 				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
 			), nil
 		}
 
-		broadcasterId, err := twitchSvc.GetBroadcasterID(req.Username)
+		limits, err := jobs.LimitsFromEnv()
 		if err != nil {
-			err = fmt.Errorf("unable to get broadcaster id of %v: %w", req.Username, err)
 			return apigateway.NewResponse(
-				http.StatusBadRequest, apigateway.NewErrorJSONString(err),
+				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
 			), nil
 		}
 
-		messageID := fmt.Sprintf("%v-%v", req.Username, uuid.New().String())
-		cfg, err := config.LoadDefaultConfig(ctx)
+		rateLimits, err := RateLimitsFromEnv()
 		if err != nil {
 			return apigateway.NewResponse(
 				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
 			), nil
 		}
 
-		sqsClient := sqs.NewFromConfig(cfg)
-		queueName := os.Getenv("SQS_QUEUE_NAME")
-		output, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-			QueueName: &queueName,
-		})
-		if err != nil {
-			return apigateway.NewResponse(
-				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
-			), nil
+		store := jobs.NewDynamoStore(dynamodb.NewFromConfig(cfg), os.Getenv("DYNAMODB_TABLE_NAME"))
+		queue := jobs.NewSQSQueue(sqs.NewFromConfig(cfg), os.Getenv("SQS_QUEUE_NAME"))
+		return NewHandlerWith(store, queue, WithLimits(limits), WithRateLimits(store, rateLimits))(ctx, event)
+	}
+}
+
+type handler struct {
+	store   jobs.JobStore
+	queue   jobs.Queue
+	limits  jobs.Limits
+	limiter *rateLimiter
+}
+
+// Option configures a handler created with NewHandlerWith.
+type Option = func(*handler)
+
+// WithLimits sets the limits requests are checked against. The processor
+// must be given the same limits.
+func WithLimits(limits jobs.Limits) func(*handler) {
+	return func(h *handler) {
+		h.limits = limits
+	}
+}
+
+// WithRateLimits limits how many jobs clients create, counting them in usage.
+// Clients are not limited otherwise.
+func WithRateLimits(usage jobs.UsageStore, limits RateLimits) func(*handler) {
+	return func(h *handler) {
+		h.limiter = &rateLimiter{usage: usage, limits: limits, now: time.Now}
+	}
+}
+
+// NewHandlerWith returns the API handler, which keeps jobs in store and
+// sends requests to queue. GET requests return the status of the job named
+// by the id path parameter, and any other request creates a job.
+func NewHandlerWith(store jobs.JobStore, queue jobs.Queue, options ...Option) func(ctx context.Context, event *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	h := handler{store: store, queue: queue, limits: jobs.DefaultLimits()}
+	for _, opt := range options {
+		opt(&h)
+	}
+
+	return func(ctx context.Context, event *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+		if event.RequestContext.HTTP.Method == http.MethodGet {
+			return h.getJob(ctx, event.PathParameters["id"]), nil
 		}
+		return h.createJob(ctx, event), nil
+	}
+}
 
-		msg := message{ID: messageID, UserID: broadcasterId, request: req}
-		b, err := json.Marshal(msg)
-		if err != nil {
-			return apigateway.NewResponse(
-				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
-			), nil
+func (h handler) getJob(ctx context.Context, id string) *events.APIGatewayV2HTTPResponse {
+	if id == "" {
+		return apigateway.NewResponse(
+			http.StatusBadRequest, apigateway.NewErrorJSONString(errors.New("missing job id")),
+		)
+	}
+
+	item, err := h.store.Get(ctx, id)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return apigateway.NewResponse(
+			http.StatusNotFound, apigateway.NewErrorJSONString(fmt.Errorf("job %v not found", id)),
+		)
+	}
+	if err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
+		)
+	}
+
+	resp := statusResponse{ID: item.ID, Status: item.Status}
+	if item.URL != nil {
+		resp.URL = *item.URL
+	}
+	if item.ErrorMsg != nil {
+		resp.Error = *item.ErrorMsg
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
+		)
+	}
+
+	return apigateway.NewResponse(http.StatusOK, string(b))
+}
+
+func (h handler) createJob(ctx context.Context, event *events.APIGatewayV2HTTPRequest) *events.APIGatewayV2HTTPResponse {
+	var c client
+	if h.limiter != nil {
+		var resp *events.APIGatewayV2HTTPResponse
+		if c, resp = h.limiter.identify(event); resp != nil {
+			return resp
+		}
+		if resp := h.limiter.allowRequest(ctx, c); resp != nil {
+			return resp
 		}
+	}
+
+	req, err := decodeRequest(event.Body, h.limits)
+	if err != nil {
+		return newBadRequestResponse(err)
+	}
 
-		messageBody := string(b)
-		_, err = sqsClient.SendMessage(
-			ctx,
-			&sqs.SendMessageInput{
-				QueueUrl:    output.QueueUrl,
-				MessageBody: &messageBody,
-			},
+	twitchSvc, err := twitch.NewServiceFromEnv()
+	if err != nil {
+		err = fmt.Errorf("unable to initialize twitch service: %w", err)
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
 		)
-		if err != nil {
-			return apigateway.NewResponse(
-				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
-			), nil
+	}
+
+	broadcasterId, err := twitchSvc.GetBroadcasterID(req.Username)
+	if err != nil {
+		err = fmt.Errorf("unable to get broadcaster id of %v: %w", req.Username, err)
+		return apigateway.NewResponse(
+			http.StatusBadRequest, apigateway.NewErrorJSONString(err),
+		)
+	}
+
+	messageID := fmt.Sprintf("%v-%v", req.Username, uuid.New().String())
+	msg := message{ID: messageID, UserID: broadcasterId, Request: req}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
+		)
+	}
+
+	// Only requests that would be compiled count against the daily quota, and
+	// the job is given back if it is not queued after all.
+	refund := func() error { return nil }
+	if h.limiter != nil {
+		if resp := h.limiter.allowJob(ctx, c); resp != nil {
+			return resp
 		}
+		refund = func() error { return h.limiter.refundJob(ctx, c) }
+	}
 
-		resp := response{ID: messageID}
-		b, err = json.Marshal(resp)
-		if err != nil {
-			return apigateway.NewResponse(
-				http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
-			), nil
+	// The job is recorded before it is sent, so that the processor never
+	// overwrites a later state with "queued".
+	if err := h.store.Put(ctx, jobs.Item{ID: messageID, Status: jobs.StatusQueued}); err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(errors.Join(err, refund())),
+		)
+	}
+
+	if err := h.queue.Send(ctx, string(b)); err != nil {
+		// The ID of the job is never returned, but its record is closed so
+		// that nothing takes it for a job that is still waiting.
+		errorMsg := fmt.Sprintf("unable to queue job: %v", err)
+		putErr := h.store.Put(ctx, jobs.Item{ID: messageID, Status: jobs.StatusFailed, ErrorMsg: &errorMsg})
+		refundErr := refund()
+		if errors.Is(err, jobs.ErrQueueFull) && putErr == nil && refundErr == nil {
+			resp := apigateway.NewResponse(http.StatusServiceUnavailable, apigateway.NewErrorJSONString(err))
+			resp.Headers["Retry-After"] = strconv.Itoa(queueFullRetryAfter)
+			return resp
 		}
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(errors.Join(err, putErr, refundErr)),
+		)
+	}
 
-		return apigateway.NewResponse(http.StatusAccepted, string(b)), nil
+	resp := response{ID: messageID}
+	b, err = json.Marshal(resp)
+	if err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
+		)
 	}
+
+	return apigateway.NewResponse(http.StatusAccepted, string(b))
 }
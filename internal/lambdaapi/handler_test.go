@@ -0,0 +1,282 @@
+package lambdaapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs/jobstest"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaapi"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitchtest"
+)
+
+var sample = filepath.Join("..", "compiler", "testdata", "sample1.mp4")
+
+type failingQueue struct{}
+
+func (failingQueue) Send(ctx context.Context, body string) error {
+	return errors.New("queue unavailable")
+}
+
+func postEvent(body string) *events.APIGatewayV2HTTPRequest {
+	event := &events.APIGatewayV2HTTPRequest{Body: body}
+	event.RequestContext.HTTP.Method = http.MethodPost
+	return event
+}
+
+func getEvent(id string) *events.APIGatewayV2HTTPRequest {
+	event := &events.APIGatewayV2HTTPRequest{PathParameters: map[string]string{"id": id}}
+	event.RequestContext.HTTP.Method = http.MethodGet
+	return event
+}
+
+func TestCreateJob(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	queue := jobs.NewMemoryQueue(1)
+	handler := lambdaapi.NewHandlerWith(store, queue)
+
+	resp, err := handler(ctx, postEvent(`{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status %v, got %v: %v", http.StatusAccepted, resp.StatusCode, resp.Body)
+	}
+
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &accepted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(accepted.ID, "streamer1-") {
+		t.Fatalf("unexpected job ID %q", accepted.ID)
+	}
+
+	item, err := store.Get(ctx, accepted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != jobs.StatusQueued {
+		t.Fatalf("expected the job to be %v, got %v", jobs.StatusQueued, item.Status)
+	}
+
+	var msg struct {
+		ID       string `json:"id"`
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+		Start    string `json:"start"`
+		End      string `json:"end"`
+		Count    int    `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(<-queue.Messages()), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != accepted.ID || msg.UserID != "1234" || msg.Username != "streamer1" ||
+		msg.Start != "2023-01-01" || msg.End != "2023-01-07" || msg.Count != 5 {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+}
+
+func TestCreateJobErrors(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	validBody := `{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 5}`
+
+	tests := map[string]struct {
+		body  string
+		queue jobs.Queue
+		want  int
+		// wantFailedJob is set when the job is recorded before the error.
+		wantFailedJob  bool
+		wantRetryAfter bool
+	}{
+		"malformed body": {
+			body:  `{"username":`,
+			queue: jobs.NewMemoryQueue(1),
+			want:  http.StatusBadRequest,
+		},
+		"unknown streamer": {
+			body:  `{"username": "nobody", "start": "2023-01-01", "end": "2023-01-07", "count": 5}`,
+			queue: jobs.NewMemoryQueue(1),
+			want:  http.StatusBadRequest,
+		},
+		"full queue": {
+			body:           validBody,
+			queue:          jobs.NewMemoryQueue(0),
+			want:           http.StatusServiceUnavailable,
+			wantFailedJob:  true,
+			wantRetryAfter: true,
+		},
+		"unavailable queue": {
+			body:          validBody,
+			queue:         failingQueue{},
+			want:          http.StatusInternalServerError,
+			wantFailedJob: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := jobstest.NewRecordingStore()
+			handler := lambdaapi.NewHandlerWith(store, tc.queue)
+
+			resp, err := handler(ctx, postEvent(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected status %v, got %v", tc.want, resp.StatusCode)
+			}
+
+			var body struct {
+				ErrMsg string `json:"error_message"`
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil || body.ErrMsg == "" {
+				t.Fatalf("expected an error message, got %v", resp.Body)
+			}
+			if got := resp.Headers["Retry-After"] != ""; got != tc.wantRetryAfter {
+				t.Fatalf("expected a Retry-After header: %v, got: %v", tc.wantRetryAfter, resp.Headers)
+			}
+
+			puts := store.Puts()
+			if !tc.wantFailedJob {
+				if len(puts) != 0 {
+					t.Fatalf("expected no job to be recorded, got %+v", puts)
+				}
+				return
+			}
+			last := puts[len(puts)-1]
+			if last.Status != jobs.StatusFailed || last.ErrorMsg == nil {
+				t.Fatalf("expected the job to be recorded as failed, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestCreateJobValidation(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	limits := jobs.Limits{MaxCount: 5, MaxRangeDays: 7}
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"invalid fields": {
+			body: `{"username": "streamer 1", "start": "2023-01-07", "end": "2023-01-01", "count": 6}`,
+			want: `{"error_message":"invalid request: username must be 1 to 25 letters, digits or underscores, end must not be before start, count must be between 1 and 5",` +
+				`"errors":[{"field":"username","message":"must be 1 to 25 letters, digits or underscores"},` +
+				`{"field":"end","message":"must not be before start"},` +
+				`{"field":"count","message":"must be between 1 and 5"}]}`,
+		},
+		"range above limit": {
+			body: `{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-31", "count": 5}`,
+			want: `{"error_message":"invalid request: end must be at most 7 days from start, counting both dates",` +
+				`"errors":[{"field":"end","message":"must be at most 7 days from start, counting both dates"}]}`,
+		},
+		"count of the wrong type": {
+			body: `{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": "5"}`,
+			want: `{"error_message":"invalid request: count must be a whole number",` +
+				`"errors":[{"field":"count","message":"must be a whole number"}]}`,
+		},
+		"date of the wrong type": {
+			body: `{"username": "streamer1", "start": 20230101, "end": "2023-01-07", "count": 5}`,
+			want: `{"error_message":"invalid request: start must be a string",` +
+				`"errors":[{"field":"start","message":"must be a string"}]}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := jobs.NewMemoryStore()
+			queue := jobs.NewMemoryQueue(1)
+			handler := lambdaapi.NewHandlerWith(store, queue, lambdaapi.WithLimits(limits))
+
+			resp, err := handler(ctx, postEvent(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected status %v, got %v", http.StatusBadRequest, resp.StatusCode)
+			}
+			if resp.Body != tc.want {
+				t.Fatalf("expected body %v, got %v", tc.want, resp.Body)
+			}
+			if len(queue.Messages()) != 0 {
+				t.Fatal("expected the request not to be queued")
+			}
+		})
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	url := "https://example.com/streamer1-1.mp4"
+	errorMsg := "no clips found"
+	for _, item := range []jobs.Item{
+		{ID: "streamer1-1", Status: jobs.StatusDone, URL: &url},
+		{ID: "streamer1-2", Status: jobs.StatusFailed, ErrorMsg: &errorMsg},
+		{ID: "streamer1-3", Status: jobs.StatusProcessing},
+	} {
+		if err := store.Put(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := lambdaapi.NewHandlerWith(store, jobs.NewMemoryQueue(1))
+
+	tests := map[string]struct {
+		id         string
+		wantStatus int
+		wantBody   string
+	}{
+		"done": {
+			id:         "streamer1-1",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"streamer1-1","status":"done","url":"https://example.com/streamer1-1.mp4"}`,
+		},
+		"failed": {
+			id:         "streamer1-2",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"streamer1-2","status":"failed","error":"no clips found"}`,
+		},
+		"processing": {
+			id:         "streamer1-3",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"streamer1-3","status":"processing"}`,
+		},
+		"unknown job": {
+			id:         "streamer1-4",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error_message":"job streamer1-4 not found"}`,
+		},
+		"missing id": {
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error_message":"missing job id"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := handler(ctx, getEvent(tc.id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("expected status %v, got %v", tc.wantStatus, resp.StatusCode)
+			}
+			if resp.Body != tc.wantBody {
+				t.Fatalf("expected body %v, got %v", tc.wantBody, resp.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package lambdaapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/apigateway"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+// apiKeyHeader is the header clients send their API key in. API Gateway
+// passes headers in lower case.
+const apiKeyHeader = "x-api-key"
+
+// Quota bounds the jobs a client can create. Zero stands for no limit.
+type Quota struct {
+	PerMinute int
+	// PerDay resets at midnight UTC.
+	PerDay int
+}
+
+// RateLimits bounds the jobs clients can create. Clients that send one of
+// APIKeys are counted by key, and any other client by source IP.
+type RateLimits struct {
+	IP      Quota
+	APIKey  Quota
+	APIKeys []string
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		IP:     Quota{PerMinute: 5, PerDay: 20},
+		APIKey: Quota{PerMinute: 30, PerDay: 500},
+	}
+}
+
+// RateLimitsFromEnv returns the default rate limits, overridden by
+// RATE_LIMIT_PER_MINUTE, DAILY_QUOTA, API_KEY_RATE_LIMIT_PER_MINUTE and
+// API_KEY_DAILY_QUOTA when they are set, with the comma separated API keys
+// of API_KEYS.
+func RateLimitsFromEnv() (RateLimits, error) {
+	limits := DefaultRateLimits()
+	for name, limit := range map[string]*int{
+		"RATE_LIMIT_PER_MINUTE":         &limits.IP.PerMinute,
+		"DAILY_QUOTA":                   &limits.IP.PerDay,
+		"API_KEY_RATE_LIMIT_PER_MINUTE": &limits.APIKey.PerMinute,
+		"API_KEY_DAILY_QUOTA":           &limits.APIKey.PerDay,
+	} {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return RateLimits{}, fmt.Errorf("%v must be a number of at least 0, got %q", name, value)
+		}
+		*limit = n
+	}
+
+	for _, key := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			limits.APIKeys = append(limits.APIKeys, key)
+		}
+	}
+	return limits, nil
+}
+
+// rateLimiter counts the jobs of every client in usage.
+type rateLimiter struct {
+	usage  jobs.UsageStore
+	limits RateLimits
+	now    func() time.Time
+}
+
+// client is who a request is counted against.
+type client struct {
+	key   string
+	quota Quota
+}
+
+// identify returns the client that sent event, or an error response for
+// unknown API keys.
+func (l *rateLimiter) identify(event *events.APIGatewayV2HTTPRequest) (client, *events.APIGatewayV2HTTPResponse) {
+	apiKey := event.Headers[apiKeyHeader]
+	if apiKey == "" {
+		return client{key: "ip#" + event.RequestContext.HTTP.SourceIP, quota: l.limits.IP}, nil
+	}
+
+	if !slices.Contains(l.limits.APIKeys, apiKey) {
+		return client{}, apigateway.NewResponse(
+			http.StatusUnauthorized, apigateway.NewErrorJSONString(errors.New("invalid API key")),
+		)
+	}
+	// Keys are not stored as they are, since the counters are readable by
+	// anyone with access to the job store.
+	hash := sha256.Sum256([]byte(apiKey))
+	return client{key: "key#" + hex.EncodeToString(hash[:16]), quota: l.limits.APIKey}, nil
+}
+
+// allowRequest counts a request of c against its rate limit, and returns a
+// 429 response once the limit is exceeded.
+func (l *rateLimiter) allowRequest(ctx context.Context, c client) *events.APIGatewayV2HTTPResponse {
+	if c.quota.PerMinute == 0 {
+		return nil
+	}
+
+	windowEnd := l.now().Truncate(time.Minute).Add(time.Minute)
+	key := fmt.Sprintf("%v#minute#%v", c.key, windowEnd.Unix())
+	err := fmt.Errorf("rate limit of %v jobs per minute exceeded, try again later", c.quota.PerMinute)
+	return l.count(ctx, key, c.quota.PerMinute, windowEnd, err)
+}
+
+// allowJob counts a job of c against its daily quota, and returns a 429
+// response once the quota is used up.
+func (l *rateLimiter) allowJob(ctx context.Context, c client) *events.APIGatewayV2HTTPResponse {
+	if c.quota.PerDay == 0 {
+		return nil
+	}
+
+	now := l.now().UTC()
+	windowEnd := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	err := fmt.Errorf("daily quota of %v jobs used up, try again tomorrow", c.quota.PerDay)
+	return l.count(ctx, dailyKey(c, now), c.quota.PerDay, windowEnd, err)
+}
+
+// refundJob gives back a job allowJob counted for c, when the job could not
+// be queued.
+func (l *rateLimiter) refundJob(ctx context.Context, c client) error {
+	if c.quota.PerDay == 0 {
+		return nil
+	}
+	return l.usage.Decrement(ctx, dailyKey(c, l.now().UTC()))
+}
+
+// dailyKey names the counter of the jobs of c on the day of now.
+func dailyKey(c client, now time.Time) string {
+	return fmt.Sprintf("%v#day#%v", c.key, now.Format(time.DateOnly))
+}
+
+func (l *rateLimiter) count(ctx context.Context, key string, limit int, windowEnd time.Time, limitErr error) *events.APIGatewayV2HTTPResponse {
+	count, err := l.usage.Increment(ctx, key, windowEnd)
+	if err != nil {
+		return apigateway.NewResponse(
+			http.StatusInternalServerError, apigateway.NewErrorJSONString(err),
+		)
+	}
+	if count <= limit {
+		return nil
+	}
+
+	resp := apigateway.NewResponse(http.StatusTooManyRequests, apigateway.NewErrorJSONString(limitErr))
+	retryAfter := max(int(math.Ceil(windowEnd.Sub(l.now()).Seconds())), 1)
+	resp.Headers["Retry-After"] = strconv.Itoa(retryAfter)
+	return resp
+}
@@ -0,0 +1,231 @@
+package lambdaapi_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaapi"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitchtest"
+)
+
+const (
+	validBody   = `{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 5}`
+	invalidBody = `{"username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 0}`
+)
+
+// clientEvent is a POST request from sourceIP, with apiKey unless it is empty.
+func clientEvent(body, sourceIP, apiKey string) *events.APIGatewayV2HTTPRequest {
+	event := postEvent(body)
+	event.RequestContext.HTTP.SourceIP = sourceIP
+	if apiKey != "" {
+		event.Headers = map[string]string{"x-api-key": apiKey}
+	}
+	return event
+}
+
+func TestRateLimits(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	limits := lambdaapi.RateLimits{
+		IP:      lambdaapi.Quota{PerMinute: 3, PerDay: 2},
+		APIKey:  lambdaapi.Quota{PerMinute: 5, PerDay: 4},
+		APIKeys: []string{"key1", "key2"},
+	}
+
+	type step struct {
+		event *events.APIGatewayV2HTTPRequest
+		want  int
+	}
+	tests := map[string]struct {
+		steps []step
+		// maxRetryAfter bounds the Retry-After of the last step, which is rejected.
+		maxRetryAfter int
+	}{
+		"rate limit per IP": {
+			steps: []step{
+				{event: clientEvent(invalidBody, "1.1.1.1", ""), want: http.StatusBadRequest},
+				{event: clientEvent(invalidBody, "1.1.1.1", ""), want: http.StatusBadRequest},
+				{event: clientEvent(invalidBody, "2.2.2.2", ""), want: http.StatusBadRequest},
+				{event: clientEvent(invalidBody, "1.1.1.1", ""), want: http.StatusBadRequest},
+				{event: clientEvent(validBody, "1.1.1.1", ""), want: http.StatusTooManyRequests},
+			},
+			maxRetryAfter: 60,
+		},
+		"daily quota per IP": {
+			steps: []step{
+				{event: clientEvent(validBody, "1.1.1.1", ""), want: http.StatusAccepted},
+				{event: clientEvent(invalidBody, "1.1.1.1", ""), want: http.StatusBadRequest},
+				{event: clientEvent(validBody, "1.1.1.1", ""), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "2.2.2.2", ""), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "1.1.1.1", ""), want: http.StatusTooManyRequests},
+			},
+			maxRetryAfter: 24 * 60 * 60,
+		},
+		"daily quota per API key": {
+			steps: []step{
+				{event: clientEvent(validBody, "1.1.1.1", "key1"), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "1.1.1.1", "key1"), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "1.1.1.1", "key1"), want: http.StatusAccepted},
+				// Requests without a key are counted apart.
+				{event: clientEvent(validBody, "1.1.1.1", ""), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "2.2.2.2", "key2"), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "2.2.2.2", "key1"), want: http.StatusAccepted},
+				{event: clientEvent(validBody, "1.1.1.1", "key1"), want: http.StatusTooManyRequests},
+			},
+			maxRetryAfter: 24 * 60 * 60,
+		},
+		"unknown API key": {
+			steps: []step{
+				{event: clientEvent(validBody, "1.1.1.1", "key3"), want: http.StatusUnauthorized},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := jobs.NewMemoryStore()
+			handler := lambdaapi.NewHandlerWith(store, jobs.NewMemoryQueue(10), lambdaapi.WithRateLimits(store, limits))
+
+			var resp *events.APIGatewayV2HTTPResponse
+			for i, step := range tc.steps {
+				var err error
+				resp, err = handler(ctx, step.event)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != step.want {
+					t.Fatalf("expected status %v for request %v, got %v: %v", step.want, i+1, resp.StatusCode, resp.Body)
+				}
+			}
+
+			if tc.maxRetryAfter == 0 {
+				return
+			}
+			retryAfter, err := strconv.Atoi(resp.Headers["Retry-After"])
+			if err != nil || retryAfter < 1 || retryAfter > tc.maxRetryAfter {
+				t.Fatalf("expected Retry-After between 1 and %v, got %q", tc.maxRetryAfter, resp.Headers["Retry-After"])
+			}
+		})
+	}
+}
+
+func TestRateLimitsSkipStatus(t *testing.T) {
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	limits := lambdaapi.RateLimits{IP: lambdaapi.Quota{PerMinute: 1, PerDay: 1}}
+	handler := lambdaapi.NewHandlerWith(store, jobs.NewMemoryQueue(1), lambdaapi.WithRateLimits(store, limits))
+
+	for i := 0; i < 3; i++ {
+		event := getEvent("streamer1-1")
+		event.RequestContext.HTTP.SourceIP = "1.1.1.1"
+		resp, err := handler(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status %v, got %v", http.StatusNotFound, resp.StatusCode)
+		}
+	}
+}
+
+func TestRateLimitsFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		want    lambdaapi.RateLimits
+		wantErr bool
+	}{
+		"defaults": {
+			want: lambdaapi.DefaultRateLimits(),
+		},
+		"overridden": {
+			env: map[string]string{
+				"RATE_LIMIT_PER_MINUTE":         "0",
+				"DAILY_QUOTA":                   "10",
+				"API_KEY_RATE_LIMIT_PER_MINUTE": "60",
+				"API_KEY_DAILY_QUOTA":           "1000",
+				"API_KEYS":                      "key1, key2,",
+			},
+			want: lambdaapi.RateLimits{
+				IP:      lambdaapi.Quota{PerMinute: 0, PerDay: 10},
+				APIKey:  lambdaapi.Quota{PerMinute: 60, PerDay: 1000},
+				APIKeys: []string{"key1", "key2"},
+			},
+		},
+		"negative": {
+			env:     map[string]string{"DAILY_QUOTA": "-1"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			got, err := lambdaapi.RateLimitsFromEnv()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitsRefundUnqueuedJobs(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	limits := lambdaapi.RateLimits{IP: lambdaapi.Quota{PerDay: 1}}
+
+	tests := map[string]struct {
+		queue jobs.Queue
+		want  int
+	}{
+		"full queue": {
+			queue: jobs.NewMemoryQueue(0),
+			want:  http.StatusServiceUnavailable,
+		},
+		"unavailable queue": {
+			queue: failingQueue{},
+			want:  http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := jobs.NewMemoryStore()
+
+			failing := lambdaapi.NewHandlerWith(store, tc.queue, lambdaapi.WithRateLimits(store, limits))
+			resp, err := failing(ctx, clientEvent(validBody, "1.1.1.1", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected status %v, got %v: %v", tc.want, resp.StatusCode, resp.Body)
+			}
+
+			// The job that was not queued does not count against the quota.
+			handler := lambdaapi.NewHandlerWith(store, jobs.NewMemoryQueue(1), lambdaapi.WithRateLimits(store, limits))
+			resp, err = handler(ctx, clientEvent(validBody, "1.1.1.1", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("expected status %v, got %v: %v", http.StatusAccepted, resp.StatusCode, resp.Body)
+			}
+		})
+	}
+}
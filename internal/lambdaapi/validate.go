@@ -0,0 +1,57 @@
+package lambdaapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/apigateway"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+)
+
+type validationResponse struct {
+	ErrMsg string            `json:"error_message"`
+	Errors []jobs.FieldError `json:"errors"`
+}
+
+// decodeRequest reads a compilation request from body and checks it against
+// limits. Fields of the wrong type are reported like invalid fields, in a
+// jobs.ValidationError.
+func decodeRequest(body string, limits jobs.Limits) (jobs.Request, error) {
+	var req jobs.Request
+	err := json.Unmarshal([]byte(body), &req)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		message := "must be a string"
+		if typeErr.Type.Kind() == reflect.Int {
+			message = "must be a whole number"
+		}
+		return jobs.Request{}, jobs.ValidationError{{Field: typeErr.Field, Message: message}}
+	}
+	if err != nil {
+		return jobs.Request{}, err
+	}
+
+	if err := req.Validate(limits); err != nil {
+		return jobs.Request{}, err
+	}
+	return req, nil
+}
+
+// newBadRequestResponse describes err, along with the invalid fields when
+// it is a jobs.ValidationError.
+func newBadRequestResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var validationErr jobs.ValidationError
+	if !errors.As(err, &validationErr) {
+		return apigateway.NewResponse(http.StatusBadRequest, apigateway.NewErrorJSONString(err))
+	}
+
+	b, err := json.Marshal(validationResponse{ErrMsg: validationErr.Error(), Errors: validationErr})
+	if err != nil {
+		return apigateway.NewResponse(http.StatusInternalServerError, apigateway.NewErrorJSONString(err))
+	}
+	return apigateway.NewResponse(http.StatusBadRequest, string(b))
+}
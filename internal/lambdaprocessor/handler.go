@@ -7,41 +7,63 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
-	"github.com/jaaanko/twitch-clip-compilation-tool/internal/downloader"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
 )
 
 type request struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Start    string `json:"start"`
-	End      string `json:"end"`
-	Count    int    `json:"count"`
-	UserID   string `json:"user_id"`
+	jobs.Request
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
 }
 
-type item struct {
-	ID       string  `dynamodbav:"id"`
-	URL      *string `dynamodbav:"url"`
-	Status   int     `dynamodbav:"status"`
-	ErrorMsg *string `dynamodbav:"error_msg"`
+type handler struct {
+	outputDir  string
+	ffmpegPath string
+	limits     jobs.Limits
 }
 
+// Option configures a handler created with NewHandlerWith.
+type Option = func(*handler)
+
 const (
 	outputDir  = "/tmp"
 	ffmpegPath = "/opt/ffmpeg"
 )
 
+// WithOutputDir sets the directory compilations are written to before they are published.
+func WithOutputDir(outputDir string) func(*handler) {
+	return func(h *handler) {
+		h.outputDir = outputDir
+	}
+}
+
+// WithLimits sets the limits requests are checked against, which should be
+// the ones given to the API.
+func WithLimits(limits jobs.Limits) func(*handler) {
+	return func(h *handler) {
+		h.limits = limits
+	}
+}
+
+func WithFFmpegPath(ffmpegPath string) func(*handler) {
+	return func(h *handler) {
+		h.ffmpegPath = ffmpegPath
+	}
+}
+
+// NewHandler returns the handler of the Lambda function, which records
+// results in the DynamoDB table named by DYNAMODB_TABLE_NAME and publishes
+// compilations to the S3 bucket named by DEST_S3_BUCKET_NAME. Requests are
+// checked against the limits set by MAX_CLIP_COUNT and MAX_RANGE_DAYS.
 func NewHandler() func(ctx context.Context, event *events.SQSEvent) error {
 	return func(ctx context.Context, event *events.SQSEvent) error {
 		cfg, err := config.LoadDefaultConfig(ctx)
@@ -49,107 +71,85 @@ func NewHandler() func(ctx context.Context, event *events.SQSEvent) error {
 			return err
 		}
 
+		limits, err := jobs.LimitsFromEnv()
+		if err != nil {
+			return err
+		}
+
+		store := jobs.NewDynamoStore(dynamodb.NewFromConfig(cfg), os.Getenv("DYNAMODB_TABLE_NAME"))
+		blobs := jobs.NewS3BlobStore(s3.NewFromConfig(cfg), os.Getenv("DEST_S3_BUCKET_NAME"))
+		return NewHandlerWith(store, blobs, WithLimits(limits))(ctx, event)
+	}
+}
+
+// NewHandlerWith returns the processor handler, which records the progress
+// of jobs in store and publishes compilations to blobs.
+func NewHandlerWith(store jobs.JobStore, blobs jobs.BlobStore, options ...Option) func(ctx context.Context, event *events.SQSEvent) error {
+	h := handler{outputDir: outputDir, ffmpegPath: ffmpegPath, limits: jobs.DefaultLimits()}
+	for _, opt := range options {
+		opt(&h)
+	}
+
+	return func(ctx context.Context, event *events.SQSEvent) (err error) {
+		if len(event.Records) == 0 {
+			return errors.New("no message to process")
+		}
+
 		var req request
 		err = json.Unmarshal([]byte(event.Records[0].Body), &req)
 		if err != nil {
 			return err
 		}
-		tableName := os.Getenv("DYNAMODB_TABLE_NAME")
-		dbClient := dynamodb.NewFromConfig(cfg)
 
 		defer func() {
 			if err != nil {
 				errorMsg := err.Error()
-				item := item{ID: req.ID, Status: 1, ErrorMsg: &errorMsg}
-				mapItem, marshalErr := attributevalue.MarshalMap(item)
-				if marshalErr != nil {
-					err = errors.Join(err, marshalErr)
-				} else {
-					dbClient.PutItem(ctx, &dynamodb.PutItemInput{
-						Item:      mapItem,
-						TableName: &tableName,
-					})
+				if putErr := store.Put(ctx, jobs.Item{ID: req.ID, Status: jobs.StatusFailed, ErrorMsg: &errorMsg}); putErr != nil {
+					err = errors.Join(err, putErr)
 				}
 			}
 		}()
 
-		clientId := os.Getenv("TWITCH_CLIENT_ID")
-		clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
-		authBaseURL := os.Getenv("TWITCH_AUTH_BASE_URL")
-		apiBaseURL := os.Getenv("TWITCH_API_BASE_URL")
+		if err = store.Put(ctx, jobs.Item{ID: req.ID, Status: jobs.StatusProcessing}); err != nil {
+			return err
+		}
 
-		twitchSvc, err := twitch.NewService(clientId, clientSecret, authBaseURL, apiBaseURL)
-		if err != nil {
+		// The API has checked the request already, unless the limits were
+		// lowered since it was queued.
+		if err = req.Validate(h.limits); err != nil {
 			return err
 		}
 
-		urls, err := twitchSvc.GetClipURLs(req.UserID, req.Start, req.End, min(req.Count, 10))
+		twitchSvc, err := twitch.NewServiceFromEnv()
 		if err != nil {
 			return err
 		}
 
-		downloadedClips, err := downloader.Run(outputDir, urls)
-		if errors.Is(err, downloader.ErrCreateOutputDir) {
+		clips, err := twitchSvc.GetClips(req.UserID, req.Start, req.End, req.Count)
+		if err != nil {
 			return err
 		}
 
 		outputFileName := fmt.Sprintf("%v-%v.mp4", req.Username, uuid.New().String())
-		compiler := compiler.New(
-			compiler.WithOutputDir(outputDir),
+		clipCompiler := compiler.New(
+			compiler.WithOutputDir(h.outputDir),
 			compiler.WithOutputFileName(outputFileName),
-			compiler.WithFFmpegPath(ffmpegPath),
+			compiler.WithFFmpegPath(h.ffmpegPath),
 		)
-		if err = compiler.Run(downloadedClips); err != nil {
-			return err
-		}
-
-		s3Client := s3.NewFromConfig(cfg)
-		uploader := manager.NewUploader(s3Client)
-		file, err := os.Open(filepath.Join(outputDir, outputFileName))
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		bucketName := os.Getenv("DEST_S3_BUCKET_NAME")
-		_, err = uploader.Upload(ctx, &s3.PutObjectInput{
-			Bucket: &bucketName,
-			Key:    &outputFileName,
-			Body:   file,
-		})
-		if err != nil {
+		if _, err = pipeline.Run(ctx, h.outputDir, twitchSvc.ClipSources(clips), clipCompiler); err != nil {
 			return err
 		}
 
-		presignClient := s3.NewPresignClient(s3Client)
-		presignedUrl, err := presignClient.PresignGetObject(ctx,
-			&s3.GetObjectInput{
-				Bucket: &bucketName,
-				Key:    &outputFileName,
-			},
-			s3.WithPresignExpires(time.Hour*1),
-		)
+		outputPath := filepath.Join(h.outputDir, outputFileName)
+		url, err := blobs.Put(ctx, outputFileName, outputPath)
 		if err != nil {
 			return err
 		}
 
-		if err := os.Remove(filepath.Join(outputDir, outputFileName)); err != nil {
-			return err
-		}
-
-		item := item{ID: req.ID, URL: &presignedUrl.URL, Status: 0}
-		mapItem, err := attributevalue.MarshalMap(item)
-		if err != nil {
-			return err
-		}
-		_, err = dbClient.PutItem(ctx, &dynamodb.PutItemInput{
-			Item:      mapItem,
-			TableName: &tableName,
-		})
-		if err != nil {
+		if err := os.Remove(outputPath); err != nil {
 			return err
 		}
 
-		return nil
+		return store.Put(ctx, jobs.Item{ID: req.ID, URL: &url, Status: jobs.StatusDone})
 	}
 }
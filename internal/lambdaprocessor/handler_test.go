@@ -0,0 +1,134 @@
+package lambdaprocessor_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/jobs/jobstest"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/lambdaprocessor"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitchtest"
+)
+
+var sample = filepath.Join("..", "compiler", "testdata", "sample1.mp4")
+
+type failingBlobStore struct{}
+
+func (failingBlobStore) Put(ctx context.Context, key, path string) (string, error) {
+	return "", errors.New("bucket unavailable")
+}
+
+func sqsEvent(body string) *events.SQSEvent {
+	return &events.SQSEvent{Records: []events.SQSMessage{{Body: body}}}
+}
+
+func TestHandler(t *testing.T) {
+	twitchtest.Serve(t, sample)
+	ctx := context.Background()
+	workDir := t.TempDir()
+	filesDir := t.TempDir()
+	store := jobstest.NewRecordingStore()
+	handler := lambdaprocessor.NewHandlerWith(
+		store,
+		jobs.NewFileBlobStore(filesDir, "http://localhost:8080/files/"),
+		lambdaprocessor.WithOutputDir(workDir),
+		// The job only reaches done if the two identical clips are joined in
+		// Go, as ffmpeg cannot be found.
+		lambdaprocessor.WithFFmpegPath(filepath.Join(workDir, "missing-ffmpeg")),
+	)
+
+	err := handler(ctx, sqsEvent(`{"id": "streamer1-1", "username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 2, "user_id": "1234"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	puts := store.Puts()
+	if len(puts) != 2 || puts[0].Status != jobs.StatusProcessing || puts[1].Status != jobs.StatusDone {
+		t.Fatalf("expected the job to go through processing to done, got %+v", puts)
+	}
+	done := puts[1]
+	if done.ID != "streamer1-1" || done.URL == nil || done.ErrorMsg != nil {
+		t.Fatalf("unexpected result %+v", done)
+	}
+
+	key := strings.TrimPrefix(*done.URL, "http://localhost:8080/files/")
+	if !strings.HasPrefix(key, "streamer1-") || !strings.HasSuffix(key, ".mp4") {
+		t.Fatalf("unexpected download URL %v", *done.URL)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, key)); err != nil {
+		t.Fatalf("expected the compilation to be published, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, key)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the compilation to be removed from the output directory, got %v", err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	twitchtest.Serve(t, sample)
+
+	tests := map[string]struct {
+		event *events.SQSEvent
+		blobs jobs.BlobStore
+		// wantError is the error recorded for the job, if the job is known.
+		wantError string
+	}{
+		"no message": {
+			event: &events.SQSEvent{},
+		},
+		"malformed message": {
+			event: sqsEvent(`{"id":`),
+		},
+		"no clips": {
+			event:     sqsEvent(`{"id": "streamer2-1", "username": "streamer2", "start": "2023-01-01", "end": "2023-01-07", "count": 2, "user_id": "5678"}`),
+			wantError: "no clips found",
+		},
+		"count above limit": {
+			event:     sqsEvent(`{"id": "streamer1-1", "username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 11, "user_id": "1234"}`),
+			wantError: "count must be between 1 and 10",
+		},
+		"unavailable blob store": {
+			event:     sqsEvent(`{"id": "streamer1-1", "username": "streamer1", "start": "2023-01-01", "end": "2023-01-07", "count": 2, "user_id": "1234"}`),
+			blobs:     failingBlobStore{},
+			wantError: "bucket unavailable",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			workDir := t.TempDir()
+			store := jobstest.NewRecordingStore()
+			blobs := tc.blobs
+			if blobs == nil {
+				blobs = jobs.NewFileBlobStore(t.TempDir(), "http://localhost:8080/files/")
+			}
+			handler := lambdaprocessor.NewHandlerWith(
+				store,
+				blobs,
+				lambdaprocessor.WithOutputDir(workDir),
+				lambdaprocessor.WithFFmpegPath(filepath.Join(workDir, "missing-ffmpeg")),
+			)
+
+			if err := handler(ctx, tc.event); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			puts := store.Puts()
+			if tc.wantError == "" {
+				if len(puts) != 0 {
+					t.Fatalf("expected no job to be recorded, got %+v", puts)
+				}
+				return
+			}
+			last := puts[len(puts)-1]
+			if last.Status != jobs.StatusFailed || last.ErrorMsg == nil || !strings.Contains(*last.ErrorMsg, tc.wantError) {
+				t.Fatalf("expected the job to fail with %q, got %+v", tc.wantError, last)
+			}
+		})
+	}
+}
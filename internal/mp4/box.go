@@ -0,0 +1,179 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// box is an ISO BMFF box held in memory.
+type box struct {
+	typ string
+	// raw is the whole box, including its header.
+	raw []byte
+	// payload is the content of the box after its header.
+	payload []byte
+}
+
+var errMalformed = errors.New("malformed mp4 file")
+
+// parseBoxes splits data into the sequence of boxes it contains.
+func parseBoxes(data []byte) ([]box, error) {
+	var boxes []box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated box header", errMalformed)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: truncated box header", errMalformed)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: invalid size for %v box", errMalformed, typ)
+		}
+
+		boxes = append(boxes, box{typ: typ, raw: data[:size], payload: data[headerSize:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// child returns the first child of b with the given type.
+func (b box) child(typ string) (box, bool) {
+	children, err := parseBoxes(b.payload)
+	if err != nil {
+		return box{}, false
+	}
+	for _, c := range children {
+		if c.typ == typ {
+			return c, true
+		}
+	}
+	return box{}, false
+}
+
+// path returns the descendant of b found by following the given box types.
+func (b box) path(types ...string) (box, bool) {
+	current := b
+	for _, typ := range types {
+		next, ok := current.child(typ)
+		if !ok {
+			return box{}, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// topLevelBoxes reads the headers of the boxes at the top of the file and
+// loads the ones named in load into memory. Media data is left on disk.
+func topLevelBoxes(r io.ReaderAt, fileSize int64, load ...string) (map[string]box, error) {
+	wanted := map[string]bool{}
+	for _, typ := range load {
+		wanted[typ] = true
+	}
+
+	boxes := map[string]box{}
+	var offset int64
+	header := make([]byte, 16)
+	for offset < fileSize {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformed, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("%w: %v", errMalformed, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+
+		if size < headerSize || offset+size > fileSize {
+			return nil, fmt.Errorf("%w: invalid size for %v box", errMalformed, typ)
+		}
+
+		if wanted[typ] {
+			raw := make([]byte, size)
+			if _, err := r.ReadAt(raw, offset); err != nil {
+				return nil, err
+			}
+			boxes[typ] = box{typ: typ, raw: raw, payload: raw[headerSize:]}
+		} else {
+			boxes[typ] = box{typ: typ}
+		}
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+// reader reads big endian values from a box payload, remembering the first error.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: unexpected end of box", errMalformed)
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) u8() uint8   { return r.next(1)[0] }
+func (r *reader) u16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *reader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *reader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+func (r *reader) skip(n int)  { r.next(n) }
+
+// fullBoxHeader reads the version and flags that start every full box.
+func (r *reader) fullBoxHeader() (version uint8, flags uint32) {
+	v := r.u32()
+	return uint8(v >> 24), v & 0xffffff
+}
+
+// appendBox appends a box with the given type and payload to b.
+func appendBox(b []byte, typ string, payload []byte) []byte {
+	size := uint64(len(payload)) + 8
+	if size > 0xffffffff {
+		b = binary.BigEndian.AppendUint32(b, 1)
+		b = append(b, typ...)
+		b = binary.BigEndian.AppendUint64(b, size+8)
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(size))
+		b = append(b, typ...)
+	}
+	return append(b, payload...)
+}
+
+// appendFullBox appends a full box, whose payload starts with a version and flags, to b.
+func appendFullBox(b []byte, typ string, version uint8, flags uint32, payload []byte) []byte {
+	content := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags&0xffffff)
+	return appendBox(b, typ, append(content, payload...))
+}
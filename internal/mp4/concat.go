@@ -0,0 +1,502 @@
+// Package mp4 joins MP4 files that share codec parameters without decoding
+// or re-muxing them through ffmpeg.
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// ErrIncompatible is returned when the files cannot be joined at the box
+// level, for example because their codec parameters differ.
+var ErrIncompatible = errors.New("files cannot be concatenated without re-muxing")
+
+// outputTrack is a track of the joined file. Its samples are expressed in the
+// timescale of the first file's track.
+type outputTrack struct {
+	template *track
+	samples  []sample
+	// chunkOffsets and chunkCounts describe the chunks in the output mdat box.
+	// Offsets are counted from the start of its payload.
+	chunkOffsets   []uint64
+	chunkCounts    []int
+	hasCompOffsets bool
+	hasSyncTable   bool
+	// shift is added to every composition offset so that they all stay positive.
+	// It is written to the edit list as the start of the presentation.
+	shift int64
+	// delay is where the presentation of tracks without composition offsets
+	// starts, such as after the priming samples of an audio codec. It is the
+	// same in every file and is added to the start of the presentation.
+	delay int64
+}
+
+// Concat writes the files at inputPaths, in order, into a single file at
+// outputPath. Sample timestamps are rewritten to the timescales of the first
+// file. ErrIncompatible is returned if the files do not have the same tracks
+// with identical sample descriptions, or have edit lists that the joined file
+// cannot reproduce.
+func Concat(outputPath string, inputPaths []string) error {
+	if len(inputPaths) == 0 {
+		return errors.New("no files to concatenate")
+	}
+
+	var movies []*movie
+	for _, path := range inputPaths {
+		m, err := readMovie(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %v: %w", path, err)
+		}
+		movies = append(movies, m)
+	}
+
+	if err := checkCompatible(movies); err != nil {
+		return err
+	}
+
+	tracks := joinSamples(movies)
+	return writeMovie(outputPath, movies, tracks)
+}
+
+// Compatible reports whether the files at path and otherPath can be joined by
+// Concat, returning ErrIncompatible if they cannot. Only the movie headers
+// are read, so files can be checked one by one as they become available.
+func Compatible(path, otherPath string) error {
+	var movies []*movie
+	for _, p := range []string{path, otherPath} {
+		m, err := readMovie(p)
+		if err != nil {
+			return fmt.Errorf("unable to read %v: %w", p, err)
+		}
+		movies = append(movies, m)
+	}
+	return checkCompatible(movies)
+}
+
+func checkCompatible(movies []*movie) error {
+	first := movies[0]
+	if len(first.tracks) == 0 {
+		return fmt.Errorf("%w: %v has no tracks", ErrIncompatible, first.path)
+	}
+	for i, t := range first.tracks {
+		if err := checkEdits(first, i, t); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range movies[1:] {
+		if len(m.tracks) != len(first.tracks) {
+			return fmt.Errorf("%w: %v has %v tracks, %v has %v",
+				ErrIncompatible, first.path, len(first.tracks), m.path, len(m.tracks))
+		}
+		for i, t := range m.tracks {
+			if t.handler != first.tracks[i].handler {
+				return fmt.Errorf("%w: track %v of %v is %v, expected %v",
+					ErrIncompatible, i+1, m.path, t.handler, first.tracks[i].handler)
+			}
+			if !bytes.Equal(t.stsd, first.tracks[i].stsd) {
+				return fmt.Errorf("%w: codec parameters of track %v differ between %v and %v",
+					ErrIncompatible, i+1, first.path, m.path)
+			}
+			if err := checkEdits(m, i, t); err != nil {
+				return err
+			}
+			if math.Abs(t.delay()-first.tracks[i].delay()) >= 1/float64(t.timescale) {
+				return fmt.Errorf("%w: presentation of track %v starts at a different time in %v and %v",
+					ErrIncompatible, i+1, first.path, m.path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkEdits returns ErrIncompatible if the edit list of a track hides more
+// of its media than the joined file can. The joined file has a single edit
+// per track, so each file may only skip the decoding delay of B-frames or the
+// priming samples of an audio codec, and must play the rest of its media.
+func checkEdits(m *movie, index int, t *track) error {
+	if len(t.edits) == 0 {
+		return nil
+	}
+
+	e := t.edits[0]
+	if len(t.edits) > 1 || e.mediaTime < 0 || e.rate != 1<<16 {
+		return fmt.Errorf("%w: edit list of track %v of %v has several, empty or slowed down edits",
+			ErrIncompatible, index+1, m.path)
+	}
+
+	start, end := t.presentation()
+	if t.hasCompOffsets && e.mediaTime > start {
+		return fmt.Errorf("%w: edit list of track %v of %v cuts the start of its media",
+			ErrIncompatible, index+1, m.path)
+	}
+	segmentEnd := e.mediaTime + rescale(int64(e.duration), m.timescale, t.timescale)
+	if e.duration > 0 && segmentEnd+int64(t.maxSampleDuration()) < end {
+		return fmt.Errorf("%w: edit list of track %v of %v cuts the end of its media",
+			ErrIncompatible, index+1, m.path)
+	}
+
+	return nil
+}
+
+// joinSamples appends the samples of every movie, converting their timestamps
+// to the output timescales. Each movie starts where the longest track of the
+// previous one ended, so audio and video stay in sync across files.
+func joinSamples(movies []*movie) []*outputTrack {
+	tracks := make([]*outputTrack, len(movies[0].tracks))
+	for i, t := range movies[0].tracks {
+		tracks[i] = &outputTrack{template: t}
+	}
+
+	for i, out := range tracks {
+		if t := out.template; !t.hasCompOffsets {
+			out.delay = t.mediaTime
+		}
+		for _, m := range movies {
+			t := m.tracks[i]
+			out.hasCompOffsets = out.hasCompOffsets || t.hasCompOffsets
+			out.hasSyncTable = out.hasSyncTable || t.hasSyncTable
+			if t.hasCompOffsets {
+				out.shift = max(out.shift, rescale(t.mediaTime, t.timescale, out.template.timescale))
+			}
+		}
+	}
+
+	// Output time, in seconds, at which the current movie starts.
+	var start float64
+	for _, m := range movies {
+		var length float64
+		for _, t := range m.tracks {
+			length = math.Max(length, t.seconds())
+		}
+
+		for i, out := range tracks {
+			t := m.tracks[i]
+			outScale := out.template.timescale
+			segmentStart := int64(math.Round(start * float64(outScale)))
+			segmentEnd := int64(math.Round((start + length) * float64(outScale)))
+			shift := out.shift
+			if t.hasCompOffsets {
+				shift -= rescale(t.mediaTime, t.timescale, outScale)
+			}
+
+			var decodeTime int64
+			for _, s := range t.samples {
+				begin := segmentStart + rescale(decodeTime, t.timescale, outScale)
+				decodeTime += int64(s.duration)
+				end := segmentStart + rescale(decodeTime, t.timescale, outScale)
+				out.samples = append(out.samples, sample{
+					size:              s.size,
+					duration:          uint32(end - begin),
+					compositionOffset: rescale(s.compositionOffset, t.timescale, outScale) + shift,
+					sync:              s.sync,
+				})
+			}
+
+			// Stretch the last sample so that the next movie starts at the
+			// same time in every track.
+			end := segmentStart + rescale(decodeTime, t.timescale, outScale)
+			if len(t.samples) > 0 && end < segmentEnd {
+				out.samples[len(out.samples)-1].duration += uint32(segmentEnd - end)
+			}
+		}
+
+		start += length
+	}
+
+	return tracks
+}
+
+func rescale(value int64, from, to uint32) int64 {
+	if from == to {
+		return value
+	}
+	return int64(math.Round(float64(value) * float64(to) / float64(from)))
+}
+
+func writeMovie(outputPath string, movies []*movie, tracks []*outputTrack) error {
+	// Chunks are copied in the order they appear in each file, which keeps
+	// the original interleaving of audio and video. Their offsets are counted
+	// from the start of the media data until the moov box is built.
+	var mdatSize uint64
+	for _, m := range movies {
+		for _, c := range m.chunks {
+			out := tracks[c.track]
+			out.chunkOffsets = append(out.chunkOffsets, mdatSize)
+			out.chunkCounts = append(out.chunkCounts, c.count)
+			mdatSize += c.size
+		}
+	}
+
+	ftyp := movies[0].ftyp
+	if ftyp == nil {
+		ftyp = appendBox(nil, "ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	}
+
+	mdatHeaderSize := uint64(8)
+	if mdatSize+8 > math.MaxUint32 {
+		mdatHeaderSize = 16
+	}
+
+	// The moov box goes before the media data, so that players can start
+	// before the whole file is downloaded. The media data then starts after
+	// it, and its size depends on whether the chunk offsets need 64 bits, so
+	// it is built again until its size no longer changes.
+	var moov []byte
+	for {
+		dataStart := uint64(len(ftyp)) + uint64(len(moov)) + mdatHeaderSize
+		next, err := buildMoov(movies[0], tracks, dataStart)
+		if err != nil {
+			return err
+		}
+		settled := len(next) == len(moov)
+		moov = next
+		if settled {
+			break
+		}
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mdatHeader := binary.BigEndian.AppendUint32(nil, uint32(mdatSize+mdatHeaderSize))
+	if mdatHeaderSize == 16 {
+		mdatHeader = binary.BigEndian.AppendUint32(nil, 1)
+		mdatHeader = append(mdatHeader, "mdat"...)
+		mdatHeader = binary.BigEndian.AppendUint64(mdatHeader, mdatSize+mdatHeaderSize)
+	} else {
+		mdatHeader = append(mdatHeader, "mdat"...)
+	}
+
+	for _, b := range [][]byte{ftyp, moov, mdatHeader} {
+		if _, err := file.Write(b); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range movies {
+		if err := copyChunks(file, m); err != nil {
+			return err
+		}
+	}
+
+	return file.Close()
+}
+
+func copyChunks(dest io.Writer, m *movie) error {
+	src, err := os.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	for _, c := range m.chunks {
+		section := io.NewSectionReader(src, int64(c.offset), int64(c.size))
+		if _, err := io.Copy(dest, section); err != nil {
+			return fmt.Errorf("unable to copy media data from %v: %w", m.path, err)
+		}
+	}
+
+	return nil
+}
+
+// buildMoov returns the moov box of the joined file, whose media data starts
+// at dataStart.
+func buildMoov(first *movie, tracks []*outputTrack, dataStart uint64) ([]byte, error) {
+	var movieDuration uint64
+	var traks []byte
+	for _, t := range tracks {
+		mediaDuration := uint64(0)
+		for _, s := range t.samples {
+			mediaDuration += uint64(s.duration)
+		}
+		trackDuration := uint64(rescale(int64(mediaDuration), t.template.timescale, first.timescale))
+		movieDuration = max(movieDuration, trackDuration)
+		trak, err := buildTrak(t, mediaDuration, trackDuration, dataStart)
+		if err != nil {
+			return nil, err
+		}
+		traks = append(traks, trak...)
+	}
+
+	mvhd := bytes.Clone(first.mvhd)
+	if err := patchDuration(mvhd, movieDuration, 16, 24); err != nil {
+		return nil, err
+	}
+
+	moov := append([]byte{}, mvhd...)
+	moov = append(moov, traks...)
+	return appendBox(nil, "moov", moov), nil
+}
+
+func buildTrak(t *outputTrack, mediaDuration, trackDuration, dataStart uint64) ([]byte, error) {
+	tkhd := bytes.Clone(t.template.tkhd)
+	if err := patchDuration(tkhd, trackDuration, 20, 28); err != nil {
+		return nil, err
+	}
+
+	var trak []byte
+	trak = append(trak, tkhd...)
+	if start := t.shift + t.delay; start > 0 {
+		elst := binary.BigEndian.AppendUint32(nil, 1)
+		elst = binary.BigEndian.AppendUint64(elst, trackDuration)
+		elst = binary.BigEndian.AppendUint64(elst, uint64(start))
+		elst = binary.BigEndian.AppendUint32(elst, 1<<16)
+		trak = appendBox(trak, "edts", appendFullBox(nil, "elst", 1, 0, elst))
+	}
+
+	var mdia []byte
+	mdhd := binary.BigEndian.AppendUint64(nil, 0)
+	mdhd = binary.BigEndian.AppendUint64(mdhd, 0)
+	mdhd = binary.BigEndian.AppendUint32(mdhd, t.template.timescale)
+	mdhd = binary.BigEndian.AppendUint64(mdhd, mediaDuration)
+	mdhd = binary.BigEndian.AppendUint16(mdhd, t.template.language)
+	mdhd = binary.BigEndian.AppendUint16(mdhd, 0)
+	mdia = appendFullBox(mdia, "mdhd", 1, 0, mdhd)
+	mdia = append(mdia, t.template.hdlr...)
+
+	var minf []byte
+	minf = append(minf, t.template.mediaHeader...)
+	minf = append(minf, t.template.dinf...)
+	minf = appendBox(minf, "stbl", buildStbl(t, dataStart))
+	mdia = appendBox(mdia, "minf", minf)
+
+	trak = appendBox(trak, "mdia", mdia)
+	return appendBox(nil, "trak", trak), nil
+}
+
+func buildStbl(t *outputTrack, dataStart uint64) []byte {
+	stbl := append([]byte{}, t.template.stsd...)
+
+	// Decoding times, run length encoded.
+	var stts []byte
+	var entries uint32
+	for i := 0; i < len(t.samples); {
+		j := i
+		for j < len(t.samples) && t.samples[j].duration == t.samples[i].duration {
+			j++
+		}
+		stts = binary.BigEndian.AppendUint32(stts, uint32(j-i))
+		stts = binary.BigEndian.AppendUint32(stts, t.samples[i].duration)
+		entries++
+		i = j
+	}
+	stbl = appendFullBox(stbl, "stts", 0, 0, append(binary.BigEndian.AppendUint32(nil, entries), stts...))
+
+	if t.hasCompOffsets {
+		// Version 1 allows negative offsets, which can appear in files that
+		// were written without an edit list.
+		version := uint8(0)
+		for _, s := range t.samples {
+			if s.compositionOffset < 0 {
+				version = 1
+				break
+			}
+		}
+
+		var ctts []byte
+		var entries uint32
+		for i := 0; i < len(t.samples); {
+			j := i
+			for j < len(t.samples) && t.samples[j].compositionOffset == t.samples[i].compositionOffset {
+				j++
+			}
+			ctts = binary.BigEndian.AppendUint32(ctts, uint32(j-i))
+			ctts = binary.BigEndian.AppendUint32(ctts, uint32(t.samples[i].compositionOffset))
+			entries++
+			i = j
+		}
+		stbl = appendFullBox(stbl, "ctts", version, 0, append(binary.BigEndian.AppendUint32(nil, entries), ctts...))
+	}
+
+	if t.hasSyncTable {
+		var stss []byte
+		var entries uint32
+		for i, s := range t.samples {
+			if s.sync {
+				stss = binary.BigEndian.AppendUint32(stss, uint32(i+1))
+				entries++
+			}
+		}
+		stbl = appendFullBox(stbl, "stss", 0, 0, append(binary.BigEndian.AppendUint32(nil, entries), stss...))
+	}
+
+	// Sample to chunk table, only listing chunks whose sample count changes.
+	var stsc []byte
+	entries = 0
+	for i, count := range t.chunkCounts {
+		if i > 0 && count == t.chunkCounts[i-1] {
+			continue
+		}
+		stsc = binary.BigEndian.AppendUint32(stsc, uint32(i+1))
+		stsc = binary.BigEndian.AppendUint32(stsc, uint32(count))
+		stsc = binary.BigEndian.AppendUint32(stsc, 1)
+		entries++
+	}
+	stbl = appendFullBox(stbl, "stsc", 0, 0, append(binary.BigEndian.AppendUint32(nil, entries), stsc...))
+
+	stsz := binary.BigEndian.AppendUint32(nil, 0)
+	stsz = binary.BigEndian.AppendUint32(stsz, uint32(len(t.samples)))
+	for _, s := range t.samples {
+		stsz = binary.BigEndian.AppendUint32(stsz, s.size)
+	}
+	stbl = appendFullBox(stbl, "stsz", 0, 0, stsz)
+
+	large := len(t.chunkOffsets) > 0 && dataStart+t.chunkOffsets[len(t.chunkOffsets)-1] > math.MaxUint32
+	offsets := binary.BigEndian.AppendUint32(nil, uint32(len(t.chunkOffsets)))
+	for _, offset := range t.chunkOffsets {
+		offset += dataStart
+		if large {
+			offsets = binary.BigEndian.AppendUint64(offsets, offset)
+		} else {
+			offsets = binary.BigEndian.AppendUint32(offsets, uint32(offset))
+		}
+	}
+	if large {
+		stbl = appendFullBox(stbl, "co64", 0, 0, offsets)
+	} else {
+		stbl = appendFullBox(stbl, "stco", 0, 0, offsets)
+	}
+
+	return stbl
+}
+
+// patchDuration overwrites the duration field of a copied mvhd or tkhd box,
+// which sits at a different offset depending on the box version.
+func patchDuration(raw []byte, duration uint64, offsetV0, offsetV1 int) error {
+	if len(raw) < 8 {
+		return fmt.Errorf("%w: box is too short", errMalformed)
+	}
+	headerSize := 8
+	if binary.BigEndian.Uint32(raw) == 1 {
+		headerSize = 16
+	}
+	if len(raw) <= headerSize {
+		return fmt.Errorf("%w: %v box is too short", errMalformed, string(raw[4:8]))
+	}
+
+	payload := raw[headerSize:]
+	offset, size := offsetV0, 4
+	if payload[0] == 1 {
+		offset, size = offsetV1, 8
+	}
+	if len(payload) < offset+size {
+		return fmt.Errorf("%w: %v box is too short", errMalformed, string(raw[4:8]))
+	}
+
+	if size == 8 {
+		binary.BigEndian.PutUint64(payload[offset:], duration)
+	} else {
+		binary.BigEndian.PutUint32(payload[offset:], uint32(min(duration, math.MaxUint32)))
+	}
+	return nil
+}
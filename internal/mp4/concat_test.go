@@ -0,0 +1,388 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/mp4"
+)
+
+var (
+	sample1 = filepath.Join("..", "compiler", "testdata", "sample1.mp4")
+	sample2 = filepath.Join("..", "compiler", "testdata", "sample2.mp4")
+)
+
+func TestConcat(t *testing.T) {
+	tests := map[string]struct {
+		inputs       []string
+		incompatible bool
+	}{
+		"same codec parameters": {
+			inputs: []string{sample1, sample1, sample1},
+		},
+		"single file": {
+			inputs: []string{sample2},
+		},
+		"different codec parameters": {
+			inputs:       []string{sample1, sample2},
+			incompatible: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "compilation.mp4")
+			err := mp4.Concat(outputPath, tc.inputs)
+			if tc.incompatible {
+				if !errors.Is(err, mp4.ErrIncompatible) {
+					t.Fatalf("expected %v, got: %v", mp4.ErrIncompatible, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := mp4.Probe(tc.inputs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := mp4.Probe(outputPath)
+			if err != nil {
+				t.Fatalf("unable to read output: %v", err)
+			}
+
+			n := len(tc.inputs)
+			if len(got.Tracks) != len(want.Tracks) {
+				t.Fatalf("expected %v tracks, got %v", len(want.Tracks), len(got.Tracks))
+			}
+			for i := range got.Tracks {
+				if got.Tracks[i].Samples != want.Tracks[i].Samples*n {
+					t.Fatalf("expected %v samples in track %v, got %v",
+						want.Tracks[i].Samples*n, i+1, got.Tracks[i].Samples)
+				}
+				if got.Tracks[i].Timescale != want.Tracks[i].Timescale {
+					t.Fatalf("expected timescale %v in track %v, got %v",
+						want.Tracks[i].Timescale, i+1, got.Tracks[i].Timescale)
+				}
+			}
+
+			wantDuration := want.Duration.Seconds() * float64(n)
+			if diff := got.Duration.Seconds() - wantDuration; diff < -0.1 || diff > 0.1 {
+				t.Fatalf("expected a duration of about %.2fs, got %v", wantDuration, got.Duration)
+			}
+
+			// The moov box comes first, so that players can start before the whole file is read.
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if findBox(t, data, "moov") > findBox(t, data, "mdat") {
+				t.Fatal("expected the moov box before the mdat box")
+			}
+
+			inputSize := int64(0)
+			for _, path := range tc.inputs {
+				info, _ := os.Stat(path)
+				inputSize += info.Size()
+			}
+			info, err := os.Stat(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() > inputSize {
+				t.Fatalf("expected output to be at most %v bytes, got %v", inputSize, info.Size())
+			}
+		})
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := map[string]struct {
+		path, otherPath string
+		incompatible    bool
+	}{
+		"same codec parameters": {
+			path:      sample1,
+			otherPath: sample1,
+		},
+		"different codec parameters": {
+			path:         sample1,
+			otherPath:    sample2,
+			incompatible: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := mp4.Compatible(tc.path, tc.otherPath)
+			if tc.incompatible {
+				if !errors.Is(err, mp4.ErrIncompatible) {
+					t.Fatalf("expected %v, got: %v", mp4.ErrIncompatible, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConcatTruncatedHeader(t *testing.T) {
+	data, err := os.ReadFile(sample1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the movie header right after its timescale, where the duration
+	// would be, and fill the rest with a free box so that no offset changes.
+	moov := findBox(t, data, "moov")
+	mvhd := moov + 8 + findBox(t, data[moov+8:], "mvhd")
+	size := int(binary.BigEndian.Uint32(data[mvhd:]))
+	truncated := bytes.Clone(data)
+	binary.BigEndian.PutUint32(truncated[mvhd:], 24)
+	binary.BigEndian.PutUint32(truncated[mvhd+24:], uint32(size-24))
+	copy(truncated[mvhd+28:], "free")
+
+	inputPath := filepath.Join(t.TempDir(), "truncated.mp4")
+	if err := os.WriteFile(inputPath, truncated, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err = mp4.Concat(filepath.Join(t.TempDir(), "compilation.mp4"), []string{inputPath, inputPath})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestConcatHugeSampleCount(t *testing.T) {
+	data, err := os.ReadFile(sample1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A constant sample size with the largest count, which would take
+	// hundreds of gigabytes to list if the count were trusted.
+	mdia := child(t, data, trackBox(t, data, 0), "mdia")
+	stsz := child(t, data, child(t, data, child(t, data, mdia, "minf"), "stbl"), "stsz")
+	binary.BigEndian.PutUint32(data[stsz+12:], 100)
+	binary.BigEndian.PutUint32(data[stsz+16:], 0xffffffff)
+
+	inputPath := filepath.Join(t.TempDir(), "huge.mp4")
+	if err := os.WriteFile(inputPath, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err = mp4.Concat(filepath.Join(t.TempDir(), "compilation.mp4"), []string{inputPath, inputPath})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// findBox returns the position of the first box of the given type in data,
+// which is a sequence of boxes.
+func findBox(t *testing.T, data []byte, typ string) int {
+	t.Helper()
+	for i := 0; i+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		if string(data[i+4:i+8]) == typ {
+			return i
+		}
+		if size < 8 {
+			break
+		}
+		i += size
+	}
+	t.Fatalf("no %v box found", typ)
+	return 0
+}
+
+func TestConcatTimescales(t *testing.T) {
+	// Both files start the audio 1024 samples in at 48kHz, but the second one
+	// counts audio time at 96kHz. Once rewritten to the timescales of the first
+	// file, the result is the same as joining the first file with itself.
+	primed := withEdit(t, 1, 18316, 1024)
+	wantPath := filepath.Join(t.TempDir(), "want.mp4")
+	if err := mp4.Concat(wantPath, []string{primed, primed}); err != nil {
+		t.Fatal(err)
+	}
+	gotPath := filepath.Join(t.TempDir(), "got.mp4")
+	if err := mp4.Concat(gotPath, []string{primed, withTimescale(t, primed, 1, 2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := mp4.Probe(wantPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := mp4.Probe(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected the tracks %+v, got %+v", want.Tracks, got.Tracks)
+	}
+
+	for path, name := range map[string]string{wantPath: "joined copies", gotPath: "rescaled join"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mediaTime := firstEditMediaTime(t, data, 1); mediaTime != 1024 {
+			t.Fatalf("expected the audio of the %v to start 1024 samples in, got %v", name, mediaTime)
+		}
+	}
+}
+
+func TestConcatEditLists(t *testing.T) {
+	tests := map[string]struct {
+		inputs       func(t *testing.T) []string
+		incompatible bool
+	}{
+		"same priming samples": {
+			inputs: func(t *testing.T) []string {
+				primed := withEdit(t, 1, 18316, 1024)
+				return []string{primed, primed}
+			},
+		},
+		"different priming samples": {
+			inputs: func(t *testing.T) []string {
+				return []string{withEdit(t, 1, 18316, 1024), sample1}
+			},
+			incompatible: true,
+		},
+		"end cut off": {
+			inputs: func(t *testing.T) []string {
+				cut := withEdit(t, 0, 600, 0)
+				return []string{cut, cut}
+			},
+			incompatible: true,
+		},
+		"empty edit": {
+			inputs: func(t *testing.T) []string {
+				return []string{sample1, withEdit(t, 0, 18020, -1)}
+			},
+			incompatible: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := mp4.Concat(filepath.Join(t.TempDir(), "compilation.mp4"), tc.inputs(t))
+			if tc.incompatible {
+				if !errors.Is(err, mp4.ErrIncompatible) {
+					t.Fatalf("expected %v, got: %v", mp4.ErrIncompatible, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// withEdit writes a copy of sample1 whose track at index has a single edit
+// with the given duration and media time, and returns its path.
+func withEdit(t *testing.T, index int, duration uint32, mediaTime int32) string {
+	t.Helper()
+	data, err := os.ReadFile(sample1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := data[firstEdit(t, data, index):]
+	binary.BigEndian.PutUint32(entry, duration)
+	binary.BigEndian.PutUint32(entry[4:], uint32(mediaTime))
+
+	path := filepath.Join(t.TempDir(), "edited.mp4")
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withTimescale writes a copy of the file at path whose track at index counts
+// time factor times finer, without changing when anything is presented, and
+// returns its path. The track must have a single decoding time entry.
+func withTimescale(t *testing.T, path string, index int, factor uint32) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scale := func(b []byte) {
+		binary.BigEndian.PutUint32(b, binary.BigEndian.Uint32(b)*factor)
+	}
+
+	trak := trackBox(t, data, index)
+	mdia := child(t, data, trak, "mdia")
+	// The timescale and duration of a version 0 media header follow the
+	// version and flags and the creation and modification times.
+	mdhd := child(t, data, mdia, "mdhd")
+	scale(data[mdhd+20:])
+	scale(data[mdhd+24:])
+
+	stts := child(t, data, child(t, data, child(t, data, mdia, "minf"), "stbl"), "stts")
+	if binary.BigEndian.Uint32(data[stts+12:]) != 1 {
+		t.Fatal("expected a single decoding time entry")
+	}
+	scale(data[stts+20:])
+
+	// The edit's duration is in the movie timescale, its media time is not.
+	scale(data[firstEdit(t, data, index)+4:])
+
+	path = filepath.Join(t.TempDir(), "rescaled.mp4")
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// trackBox returns the position of the track at index in data, a whole file.
+func trackBox(t *testing.T, data []byte, index int) int {
+	t.Helper()
+	trak := findBox(t, data, "moov") + 8
+	for i := 0; ; i++ {
+		trak += findBox(t, data[trak:], "trak")
+		if i == index {
+			return trak
+		}
+		trak += int(binary.BigEndian.Uint32(data[trak:]))
+	}
+}
+
+// child returns the position of the first child box of the given type of the
+// box at parent.
+func child(t *testing.T, data []byte, parent int, typ string) int {
+	t.Helper()
+	end := parent + int(binary.BigEndian.Uint32(data[parent:]))
+	return parent + 8 + findBox(t, data[parent+8:end], typ)
+}
+
+// firstEditMediaTime returns where the first edit of the track at index
+// starts in the media.
+func firstEditMediaTime(t *testing.T, data []byte, index int) int64 {
+	t.Helper()
+	edit := firstEdit(t, data, index)
+	// The version is the first byte after the 8 byte box header.
+	if data[edit-8] == 1 {
+		return int64(binary.BigEndian.Uint64(data[edit+8:]))
+	}
+	return int64(int32(binary.BigEndian.Uint32(data[edit+4:])))
+}
+
+// firstEdit returns the position of the first edit list entry of the track
+// at index, which follows the box header, the version and flags and the
+// entry count.
+func firstEdit(t *testing.T, data []byte, index int) int {
+	t.Helper()
+	return child(t, data, child(t, data, trackBox(t, data, index), "edts"), "elst") + 16
+}
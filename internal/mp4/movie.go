@@ -0,0 +1,479 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type sample struct {
+	size     uint32
+	duration uint32
+	// compositionOffset is the difference between presentation and decoding time.
+	compositionOffset int64
+	sync              bool
+}
+
+type chunk struct {
+	track  int
+	offset uint64
+	size   uint64
+	// first is the index of the chunk's first sample in its track.
+	first int
+	count int
+}
+
+type track struct {
+	handler   string
+	timescale uint32
+	language  uint16
+	// mediaTime is where the presentation starts in the media, taken from the
+	// edit list. Encoders use it to hide the delay introduced by B-frames, or
+	// the priming samples of audio codecs.
+	mediaTime int64
+	edits     []edit
+
+	// Boxes copied verbatim into the output.
+	tkhd        []byte
+	hdlr        []byte
+	mediaHeader []byte
+	dinf        []byte
+	stsd        []byte
+
+	samples        []sample
+	hasCompOffsets bool
+	hasSyncTable   bool
+}
+
+// edit is an entry of a track's edit list.
+type edit struct {
+	// duration of the segment in the movie timescale.
+	duration uint64
+	// mediaTime is where the segment starts in the media, or -1 for an empty edit.
+	mediaTime int64
+	// rate is a 16.16 fixed point number.
+	rate uint32
+}
+
+type movie struct {
+	path      string
+	ftyp      []byte
+	mvhd      []byte
+	timescale uint32
+	tracks    []*track
+	// chunks of all tracks, ordered by their position in the file.
+	chunks []chunk
+}
+
+func (t *track) duration() uint64 {
+	var d uint64
+	for _, s := range t.samples {
+		d += uint64(s.duration)
+	}
+	return d
+}
+
+// presentation returns the composition time of the first and the end of the
+// last sample of the track.
+func (t *track) presentation() (start, end int64) {
+	var decodeTime int64
+	for i, s := range t.samples {
+		begin := decodeTime + s.compositionOffset
+		if i == 0 || begin < start {
+			start = begin
+		}
+		end = max(end, begin+int64(s.duration))
+		decodeTime += int64(s.duration)
+	}
+	return start, end
+}
+
+// maxSampleDuration returns the duration of the longest sample of the track.
+func (t *track) maxSampleDuration() uint32 {
+	var longest uint32
+	for _, s := range t.samples {
+		longest = max(longest, s.duration)
+	}
+	return longest
+}
+
+// delay returns where the presentation of a track without composition offsets
+// starts in seconds. Tracks with composition offsets are realigned when they
+// are joined, so their delay is 0.
+func (t *track) delay() float64 {
+	if t.hasCompOffsets {
+		return 0
+	}
+	return float64(t.mediaTime) / float64(t.timescale)
+}
+
+// seconds returns the decoding duration of the track in seconds.
+func (t *track) seconds() float64 {
+	return float64(t.duration()) / float64(t.timescale)
+}
+
+func readMovie(path string) (*movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	top, err := topLevelBoxes(file, info.Size(), "ftyp", "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := top["moof"]; ok {
+		return nil, fmt.Errorf("%w: fragmented files are not supported", ErrIncompatible)
+	}
+
+	moov, ok := top["moov"]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing moov box", errMalformed)
+	}
+
+	m := &movie{path: path, ftyp: top["ftyp"].raw}
+	children, err := parseBoxes(moov.payload)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range children {
+		switch child.typ {
+		case "mvhd":
+			m.mvhd = child.raw
+			r := reader{data: child.payload}
+			version, _ := r.fullBoxHeader()
+			if version == 1 {
+				r.skip(16)
+			} else {
+				r.skip(8)
+			}
+			m.timescale = r.u32()
+			if r.err != nil {
+				return nil, r.err
+			}
+		case "trak":
+			t, err := parseTrack(child, info.Size())
+			if err != nil {
+				return nil, err
+			}
+			chunks, err := parseChunks(child, len(m.tracks), t)
+			if err != nil {
+				return nil, err
+			}
+			m.tracks = append(m.tracks, t)
+			m.chunks = append(m.chunks, chunks...)
+		}
+	}
+
+	if m.mvhd == nil || m.timescale == 0 {
+		return nil, fmt.Errorf("%w: missing movie header", errMalformed)
+	}
+
+	sort.SliceStable(m.chunks, func(i, j int) bool {
+		return m.chunks[i].offset < m.chunks[j].offset
+	})
+
+	return m, nil
+}
+
+// parseTrack reads a track of a file of fileSize bytes.
+func parseTrack(trak box, fileSize int64) (*track, error) {
+	t := &track{}
+
+	tkhd, ok := trak.child("tkhd")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing track header", errMalformed)
+	}
+	t.tkhd = tkhd.raw
+
+	mdia, ok := trak.child("mdia")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing media box", errMalformed)
+	}
+
+	mdhd, ok := mdia.child("mdhd")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing media header", errMalformed)
+	}
+	r := reader{data: mdhd.payload}
+	version, _ := r.fullBoxHeader()
+	if version == 1 {
+		r.skip(16)
+		t.timescale = r.u32()
+		r.skip(8)
+	} else {
+		r.skip(8)
+		t.timescale = r.u32()
+		r.skip(4)
+	}
+	t.language = r.u16()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if t.timescale == 0 {
+		return nil, fmt.Errorf("%w: track has a timescale of 0", errMalformed)
+	}
+
+	hdlr, ok := mdia.child("hdlr")
+	if !ok || len(hdlr.payload) < 12 {
+		return nil, fmt.Errorf("%w: missing handler", errMalformed)
+	}
+	t.hdlr = hdlr.raw
+	t.handler = string(hdlr.payload[8:12])
+
+	minf, ok := mdia.child("minf")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing media information", errMalformed)
+	}
+	for _, typ := range []string{"vmhd", "smhd", "sthd", "nmhd"} {
+		if header, ok := minf.child(typ); ok {
+			t.mediaHeader = header.raw
+			break
+		}
+	}
+	if dinf, ok := minf.child("dinf"); ok {
+		t.dinf = dinf.raw
+	}
+
+	stbl, ok := minf.child("stbl")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing sample table", errMalformed)
+	}
+
+	stsd, ok := stbl.child("stsd")
+	if !ok || len(stsd.payload) < 8 {
+		return nil, fmt.Errorf("%w: missing sample description", errMalformed)
+	}
+	if binary.BigEndian.Uint32(stsd.payload[4:]) != 1 {
+		return nil, fmt.Errorf("%w: tracks with several sample descriptions are not supported", ErrIncompatible)
+	}
+	t.stsd = stsd.raw
+
+	if elst, ok := trak.path("edts", "elst"); ok {
+		edits, err := parseEdits(elst)
+		if err != nil {
+			return nil, err
+		}
+		t.edits = edits
+		// The first edit that is not an empty edit starts the presentation.
+		for _, e := range edits {
+			if e.mediaTime >= 0 {
+				t.mediaTime = e.mediaTime
+				break
+			}
+		}
+	}
+
+	if err := parseSamples(stbl, t, fileSize); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func parseEdits(elst box) ([]edit, error) {
+	r := reader{data: elst.payload}
+	version, _ := r.fullBoxHeader()
+	count := r.u32()
+	var edits []edit
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		var e edit
+		if version == 1 {
+			e.duration = r.u64()
+			e.mediaTime = int64(r.u64())
+		} else {
+			e.duration = uint64(r.u32())
+			e.mediaTime = int64(int32(r.u32()))
+		}
+		e.rate = r.u32()
+		edits = append(edits, e)
+	}
+	return edits, r.err
+}
+
+// parseSamples reads the sample table of a track. The samples are counted
+// before they are read, so the count is checked against what the file can
+// hold rather than trusted.
+func parseSamples(stbl box, t *track, fileSize int64) error {
+	stsz, ok := stbl.child("stsz")
+	if !ok {
+		return fmt.Errorf("%w: compact sample sizes are not supported", ErrIncompatible)
+	}
+	r := reader{data: stsz.payload}
+	r.fullBoxHeader()
+	sampleSize := r.u32()
+	count := r.u32()
+	if r.err != nil {
+		return r.err
+	}
+	if sampleSize == 0 && uint64(len(r.data)) < uint64(count)*4 {
+		return fmt.Errorf("%w: sample size table is too short", errMalformed)
+	}
+	if sampleSize != 0 && uint64(count)*uint64(sampleSize) > uint64(fileSize) {
+		return fmt.Errorf("%w: %v samples of %v bytes do not fit in the file", errMalformed, count, sampleSize)
+	}
+
+	t.samples = make([]sample, count)
+	for i := range t.samples {
+		t.samples[i].size = sampleSize
+		if sampleSize == 0 {
+			t.samples[i].size = r.u32()
+		}
+		t.samples[i].sync = true
+	}
+
+	stts, ok := stbl.child("stts")
+	if !ok {
+		return fmt.Errorf("%w: missing decoding times", errMalformed)
+	}
+	r = reader{data: stts.payload}
+	r.fullBoxHeader()
+	entries := r.u32()
+	i := 0
+	for e := uint32(0); e < entries && r.err == nil; e++ {
+		n, delta := r.u32(), r.u32()
+		for ; n > 0 && i < len(t.samples); n-- {
+			t.samples[i].duration = delta
+			i++
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if ctts, ok := stbl.child("ctts"); ok {
+		t.hasCompOffsets = true
+		r = reader{data: ctts.payload}
+		version, _ := r.fullBoxHeader()
+		entries := r.u32()
+		i := 0
+		for e := uint32(0); e < entries && r.err == nil; e++ {
+			n, raw := r.u32(), r.u32()
+			offset := int64(raw)
+			if version == 1 {
+				offset = int64(int32(raw))
+			}
+			for ; n > 0 && i < len(t.samples); n-- {
+				t.samples[i].compositionOffset = offset
+				i++
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+
+	if stss, ok := stbl.child("stss"); ok {
+		t.hasSyncTable = true
+		for i := range t.samples {
+			t.samples[i].sync = false
+		}
+		r = reader{data: stss.payload}
+		r.fullBoxHeader()
+		entries := r.u32()
+		for e := uint32(0); e < entries && r.err == nil; e++ {
+			n := r.u32()
+			if n == 0 || int(n) > len(t.samples) {
+				return fmt.Errorf("%w: sync sample out of range", errMalformed)
+			}
+			t.samples[n-1].sync = true
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+// parseChunks lists the chunks of a track using its sample-to-chunk and chunk offset tables.
+func parseChunks(trak box, trackIndex int, t *track) ([]chunk, error) {
+	stbl, _ := trak.path("mdia", "minf", "stbl")
+
+	var offsets []uint64
+	if stco, ok := stbl.child("stco"); ok {
+		r := reader{data: stco.payload}
+		r.fullBoxHeader()
+		n := r.u32()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			offsets = append(offsets, uint64(r.u32()))
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	} else if co64, ok := stbl.child("co64"); ok {
+		r := reader{data: co64.payload}
+		r.fullBoxHeader()
+		n := r.u32()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			offsets = append(offsets, r.u64())
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	} else {
+		return nil, fmt.Errorf("%w: missing chunk offsets", errMalformed)
+	}
+
+	stsc, ok := stbl.child("stsc")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing sample to chunk table", errMalformed)
+	}
+	type stscEntry struct {
+		firstChunk      uint32
+		samplesPerChunk uint32
+	}
+	var entries []stscEntry
+	r := reader{data: stsc.payload}
+	r.fullBoxHeader()
+	n := r.u32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		entry := stscEntry{firstChunk: r.u32(), samplesPerChunk: r.u32()}
+		if r.u32() != 1 && r.err == nil {
+			return nil, fmt.Errorf("%w: tracks with several sample descriptions are not supported", ErrIncompatible)
+		}
+		entries = append(entries, entry)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var chunks []chunk
+	sampleIndex := 0
+	for e, entry := range entries {
+		last := uint32(len(offsets))
+		if e+1 < len(entries) {
+			last = entries[e+1].firstChunk - 1
+		}
+		for c := entry.firstChunk; c <= last; c++ {
+			if c == 0 || int(c) > len(offsets) {
+				return nil, fmt.Errorf("%w: chunk out of range", errMalformed)
+			}
+			ch := chunk{track: trackIndex, offset: offsets[c-1], first: sampleIndex}
+			for s := uint32(0); s < entry.samplesPerChunk; s++ {
+				if sampleIndex >= len(t.samples) {
+					return nil, fmt.Errorf("%w: more samples in chunks than in the sample table", errMalformed)
+				}
+				ch.size += uint64(t.samples[sampleIndex].size)
+				ch.count++
+				sampleIndex++
+			}
+			chunks = append(chunks, ch)
+		}
+	}
+
+	if sampleIndex != len(t.samples) {
+		return nil, fmt.Errorf("%w: samples missing from chunks", errMalformed)
+	}
+
+	return chunks, nil
+}
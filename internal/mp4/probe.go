@@ -0,0 +1,41 @@
+package mp4
+
+import (
+	"math"
+	"time"
+)
+
+type Info struct {
+	Duration time.Duration
+	Tracks   []TrackInfo
+}
+
+type TrackInfo struct {
+	// Handler is the track type, such as "vide" or "soun".
+	Handler   string
+	Timescale uint32
+	Samples   int
+	Duration  time.Duration
+}
+
+// Probe reads the track layout and duration of the MP4 file at path.
+func Probe(path string) (*Info, error) {
+	m, err := readMovie(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	for _, t := range m.tracks {
+		duration := time.Duration(math.Round(t.seconds() * float64(time.Second)))
+		info.Tracks = append(info.Tracks, TrackInfo{
+			Handler:   t.handler,
+			Timescale: t.timescale,
+			Samples:   len(t.samples),
+			Duration:  duration,
+		})
+		info.Duration = max(info.Duration, duration)
+	}
+
+	return info, nil
+}
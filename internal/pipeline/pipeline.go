@@ -0,0 +1,79 @@
+// Package pipeline connects the downloader and the compiler so that each clip
+// is processed as soon as its download finishes.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/downloader"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+type Compiler interface {
+	RunStream(ctx context.Context, clips <-chan compiler.Clip) (compiler.Report, error)
+}
+
+// Run downloads the clips and compiles them with c, keeping the order of
+// sources. Each clip keeps the view count of its source. Clips are downloaded into a directory of their own inside
+// outputDir, which is removed once the run is over, whether it succeeded or
+// not. A failed download is handed to c as a clip with an error, which only
+// drops it from the compilation like a clip the compiler could not process,
+// unless c is strict. Canceling ctx aborts the downloads and the compilation.
+func Run(ctx context.Context, outputDir string, sources []twitch.ClipSource, c Compiler) (compiler.Report, error) {
+	return RunSections(ctx, outputDir, sources, nil, c)
+}
+
+// RunSections is like Run for compilations split into sections, such as the
+// clips of each channel. sections[i] is the section of sources[i]; with nil
+// sections no clip belongs to a section.
+func RunSections(ctx context.Context, outputDir string, sources []twitch.ClipSource, sections []string, c Compiler) (compiler.Report, error) {
+	if err := os.MkdirAll(outputDir, 0750); err != nil {
+		return compiler.Report{}, errors.Join(downloader.ErrCreateOutputDir, err)
+	}
+
+	workDir, err := os.MkdirTemp(outputDir, ".download-")
+	if err != nil {
+		return compiler.Report{}, errors.Join(downloader.ErrCreateOutputDir, err)
+	}
+	defer os.RemoveAll(workDir)
+
+	downloads := Downloads(sources)
+	results, err := downloader.Stream(ctx, workDir, downloads)
+	if err != nil {
+		return compiler.Report{}, err
+	}
+
+	clips := make(chan compiler.Clip, len(downloads))
+	go func() {
+		defer close(clips)
+		for result := range results {
+			clip := compiler.Clip{Index: result.Index, Path: result.Path, Views: sources[result.Index].ViewCount}
+			if result.Err != nil {
+				clip = compiler.Clip{
+					Index: result.Index,
+					Err:   fmt.Errorf("%v: %w", downloads[result.Index].Name, result.Err),
+				}
+			}
+			if sections != nil {
+				clip.Section = sections[result.Index]
+			}
+			clips <- clip
+		}
+	}()
+
+	return c.RunStream(ctx, clips)
+}
+
+// Downloads names the download of each clip source after its clip ID, which
+// is unique on twitch.
+func Downloads(sources []twitch.ClipSource) []downloader.Download {
+	downloads := make([]downloader.Download, len(sources))
+	for i, source := range sources {
+		downloads[i] = downloader.Download{Name: source.ClipID + ".mp4", URL: source.URL}
+	}
+	return downloads
+}
@@ -0,0 +1,114 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/compiler"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/pipeline"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+type recordingCompiler struct {
+	received []compiler.Clip
+}
+
+func (rc *recordingCompiler) RunStream(ctx context.Context, clips <-chan compiler.Clip) (compiler.Report, error) {
+	var report compiler.Report
+	for clip := range clips {
+		if clip.Err != nil {
+			report.Skipped = append(report.Skipped, compiler.SkippedClip{Clip: clip, Err: clip.Err})
+			continue
+		}
+		rc.received = append(rc.received, clip)
+		report.Included = append(report.Included, clip)
+	}
+	return report, nil
+}
+
+func TestRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Dir(r.URL.Path) {
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("clip data"))
+	}))
+	defer server.Close()
+
+	// Every source shares the same file name, so files must be named after the clip IDs.
+	var sources []twitch.ClipSource
+	for _, id := range []string{"slow", "broken", "fast"} {
+		sources = append(sources, twitch.ClipSource{ClipID: id, URL: fmt.Sprintf("%v/%v/1080.mp4", server.URL, id)})
+	}
+
+	outputDir := t.TempDir()
+	rc := &recordingCompiler{}
+	report, err := pipeline.Run(context.Background(), outputDir, sources, rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Skipped) != 1 || report.Skipped[0].Index != 1 || !strings.Contains(report.Skipped[0].Error(), "broken.mp4") {
+		t.Fatalf("expected the failed download to be reported as skipped, got: %v", report.Skipped)
+	}
+
+	// Clips are handed over as soon as they are downloaded, with their original positions.
+	var got []string
+	for _, clip := range rc.received {
+		got = append(got, fmt.Sprintf("%v:%v", clip.Index, filepath.Base(clip.Path)))
+	}
+	want := []string{"2:fast.mp4", "0:slow.mp4"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	// The downloads are removed together with the run's working directory.
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the output directory to be empty, found %v entries", len(entries))
+	}
+}
+
+func TestRunSections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("clip data"))
+	}))
+	defer server.Close()
+
+	var sources []twitch.ClipSource
+	for i, id := range []string{"a", "b", "c"} {
+		sources = append(sources, twitch.ClipSource{ClipID: id, URL: fmt.Sprintf("%v/%v.mp4", server.URL, id), ViewCount: (i + 1) * 100})
+	}
+
+	rc := &recordingCompiler{}
+	sections := []string{"streamer1", "streamer1", "streamer2"}
+	if _, err := pipeline.RunSections(context.Background(), t.TempDir(), sources, sections, rc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clips keep the section and the view count of their source.
+	got := map[int]string{}
+	for _, clip := range rc.received {
+		got[clip.Index] = fmt.Sprintf("%v:%v", clip.Section, clip.Views)
+	}
+	want := map[int]string{0: "streamer1:100", 1: "streamer1:200", 2: "streamer2:300"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,202 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCron = errors.New("invalid cron expression")
+
+// cronSearchLimit bounds the search for the next or previous activation, so
+// that expressions such as "0 0 30 2 *" do not search forever.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Cron is a standard five field cron expression: minute, hour, day of month,
+// month and day of week. Fields accept *, lists, ranges and steps, such as
+// "*/15", "1-5" or "0,30". Times are matched in the location of the time
+// they are compared with.
+type Cron struct {
+	minute, hour, dom, month, dow bitset
+	// Like cron, a day matches either day field when both are restricted.
+	domRestricted, dowRestricted bool
+}
+
+type bitset uint64
+
+func (b bitset) has(i int) bool {
+	return b&(1<<uint(i)) != 0
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// ParseCron parses a cron expression, or one of the @hourly, @daily,
+// @weekly, @monthly and @yearly shorthands.
+func ParseCron(s string) (Cron, error) {
+	expr := strings.TrimSpace(s)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Cron{}, fmt.Errorf("%w %q: expected 5 fields, got %v", errInvalidCron, s, len(fields))
+	}
+
+	var c Cron
+	var err error
+	parsers := []struct {
+		name     string
+		dest     *bitset
+		min, max int
+	}{
+		{"minute", &c.minute, 0, 59},
+		{"hour", &c.hour, 0, 23},
+		{"day of month", &c.dom, 1, 31},
+		{"month", &c.month, 1, 12},
+		// Sunday is both 0 and 7.
+		{"day of week", &c.dow, 0, 7},
+	}
+	for i, p := range parsers {
+		if *p.dest, err = parseCronField(fields[i], p.min, p.max); err != nil {
+			return Cron{}, fmt.Errorf("%w %q: %v: %v", errInvalidCron, s, p.name, err)
+		}
+	}
+	if c.dow.has(7) {
+		c.dow |= 1
+	}
+	// Like cron, a field starting with "*", such as "*/2", is not a restriction.
+	c.domRestricted = !strings.HasPrefix(fields[2], "*")
+	c.dowRestricted = !strings.HasPrefix(fields[4], "*")
+
+	if c.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Cron{}, fmt.Errorf("%w %q: never matches", errInvalidCron, s)
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (bitset, error) {
+	var set bitset
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		var from, to int
+		switch {
+		case rangePart == "*":
+			from, to = min, max
+		case strings.Contains(rangePart, "-"):
+			start, end, _ := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = parseCronValue(start, min, max); err != nil {
+				return 0, err
+			}
+			if to, err = parseCronValue(end, min, max); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := parseCronValue(rangePart, min, max)
+			if err != nil {
+				return 0, err
+			}
+			from, to = n, n
+			// "5/10" means every 10 starting at 5.
+			if hasStep {
+				to = max
+			}
+		}
+
+		for i := from; i <= to; i += step {
+			set |= 1 << uint(i)
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %v out of range %v-%v", n, min, max)
+	}
+	return n, nil
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	dom := c.dom.has(t.Day())
+	dow := c.dow.has(int(t.Weekday()))
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first activation after t, or the zero time if there is
+// none within the next few years.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(cronSearchLimit)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case !c.month.has(int(m)):
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !c.hour.has(t.Hour()):
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Prev returns the last activation at or before t, or the zero time if there
+// is none within the last few years.
+func (c Cron) Prev(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(-cronSearchLimit)
+	t = t.Truncate(time.Minute)
+	for t.After(limit) {
+		y, m, d := t.Date()
+		switch {
+		case !c.month.has(int(m)):
+			t = time.Date(y, m, 1, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !c.hour.has(t.Hour()):
+			t = time.Date(y, m, d, t.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+		case !c.minute.has(t.Minute()):
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
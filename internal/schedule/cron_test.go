@@ -0,0 +1,100 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/schedule"
+)
+
+func TestCronNextAndPrev(t *testing.T) {
+	// 2024-01-10 is a Wednesday.
+	at := time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC)
+	tests := map[string]struct {
+		expr     string
+		wantNext time.Time
+		wantPrev time.Time
+	}{
+		"every minute": {
+			expr:     "* * * * *",
+			wantNext: time.Date(2024, 1, 10, 12, 31, 0, 0, time.UTC),
+			wantPrev: at,
+		},
+		"every 15 minutes": {
+			expr:     "*/15 * * * *",
+			wantNext: time.Date(2024, 1, 10, 12, 45, 0, 0, time.UTC),
+			wantPrev: at,
+		},
+		"weekly on monday": {
+			expr:     "0 6 * * 1",
+			wantNext: time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 8, 6, 0, 0, 0, time.UTC),
+		},
+		"sunday as 7": {
+			expr:     "0 0 * * 7",
+			wantNext: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+		},
+		"weekdays at two times": {
+			expr:     "0 9,18 * * 1-5",
+			wantNext: time.Date(2024, 1, 10, 18, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC),
+		},
+		"monthly shorthand": {
+			expr:     "@monthly",
+			wantNext: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"day of month or day of week": {
+			expr:     "0 0 1 * 5",
+			wantNext: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+		"odd days that are mondays": {
+			expr:     "0 0 */2 * 1",
+			wantNext: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"leap day": {
+			expr:     "0 0 29 2 *",
+			wantNext: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cron, err := schedule.ParseCron(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cron.Next(at); !got.Equal(tc.wantNext) {
+				t.Errorf("expected next %v, got %v", tc.wantNext, got)
+			}
+			if got := cron.Prev(at); !got.Equal(tc.wantPrev) {
+				t.Errorf("expected previous %v, got %v", tc.wantPrev, got)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"0 0 30 2 *",
+	} {
+		if _, err := schedule.ParseCron(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
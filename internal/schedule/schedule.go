@@ -0,0 +1,129 @@
+// Package schedule runs compilations on a recurring schedule. Every job
+// compiles the clips created since its previous run, and its progress is kept
+// in a state file so that consecutive runs never cover the same period, even
+// across restarts.
+package schedule
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/config"
+)
+
+// Schedule is the list of jobs read from a schedule file.
+type Schedule struct {
+	Jobs []Job `yaml:"jobs"`
+}
+
+// Job compiles the clips of a streamer whenever its cron expression matches.
+type Job struct {
+	// Name identifies the job in the state file. Defaults to the streamer.
+	Name     string `yaml:"name"`
+	Streamer string `yaml:"streamer"`
+	Cron     string `yaml:"cron"`
+	// Recipe of the config file the job's settings are applied over. Defaults
+	// to the recipe named after the streamer, if there is one.
+	Recipe string `yaml:"recipe"`
+	// Clips and Followed are the other modes of the run command. Jobs only
+	// compile the clips of their streamer, so Validate rejects them.
+	Clips           string `yaml:"clips"`
+	Followed        bool   `yaml:"followed"`
+	config.Settings `yaml:",inline"`
+}
+
+// Load reads the schedule file at path. Unknown keys are reported as errors,
+// like in the config file.
+func Load(path string) (Schedule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	var schedule Schedule
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&schedule); err != nil && !errors.Is(err, io.EOF) {
+		return Schedule{}, fmt.Errorf("unable to parse schedule file %v: %v", path, err)
+	}
+
+	for i, job := range schedule.Jobs {
+		if job.Name == "" {
+			schedule.Jobs[i].Name = job.Streamer
+		}
+	}
+	return schedule, nil
+}
+
+// Validate checks every job of the schedule against cfg, which provides
+// the recipes and presets jobs refer to, and reports all problems at once.
+func (s Schedule) Validate(cfg config.Config) error {
+	if len(s.Jobs) == 0 {
+		return errors.New("jobs: no jobs to schedule")
+	}
+
+	var errs []error
+	seen := map[string]bool{}
+	for i, job := range s.Jobs {
+		prefix := fmt.Sprintf("jobs[%v]", i)
+		if job.Name != "" {
+			prefix = fmt.Sprintf("jobs.%v", job.Name)
+		}
+
+		if job.Streamer == "" {
+			errs = append(errs, fmt.Errorf("%v.streamer: is required", prefix))
+		}
+		if job.Clips != "" {
+			errs = append(errs, fmt.Errorf("%v.clips: jobs compile the clips of their streamer, not a list of clips", prefix))
+		}
+		if job.Followed {
+			errs = append(errs, fmt.Errorf("%v.followed: jobs compile the clips of their streamer, not of followed channels", prefix))
+		}
+		if seen[job.Name] {
+			errs = append(errs, fmt.Errorf("%v.name: is used by another job", prefix))
+		}
+		seen[job.Name] = true
+
+		if _, err := ParseCron(job.Cron); err != nil {
+			errs = append(errs, fmt.Errorf("%v.cron: %v", prefix, err))
+		}
+
+		settings, err := job.ResolveSettings(cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v.recipe: %v", prefix, err))
+			continue
+		}
+		if err := cfg.ValidateSettings(prefix+".", settings); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResolveSettings returns the job's settings applied over its recipe.
+func (j Job) ResolveSettings(cfg config.Config) (config.Settings, error) {
+	recipe := j.Recipe
+	if recipe == "" && cfg.HasRecipe(j.Streamer) {
+		recipe = j.Streamer
+	}
+
+	settings, err := cfg.Recipe(recipe)
+	if err != nil {
+		return config.Settings{}, err
+	}
+	return settings.Merge(j.Settings), nil
+}
+
+// DefaultOutputFile returns the name of the compilation of the run covering
+// window, for jobs whose settings do not name one. Names include the time the
+// window ends, so that jobs running several times a day never overwrite an
+// earlier compilation.
+func (j Job) DefaultOutputFile(window Window) string {
+	return fmt.Sprintf("%v-%v.mp4", j.Name, window.End.Format("2006-01-02T1504"))
+}
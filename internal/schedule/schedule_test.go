@@ -0,0 +1,71 @@
+package schedule_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/config"
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/schedule"
+)
+
+func TestLoad(t *testing.T) {
+	s, err := schedule.Load(filepath.Join("testdata", "schedule.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %v", len(s.Jobs))
+	}
+	if s.Jobs[0].Name != "streamer1" {
+		t.Errorf("expected the name to default to the streamer, got %q", s.Jobs[0].Name)
+	}
+	if s.Jobs[0].Filters.MinViews != 100 || s.Jobs[0].OutputDir != "recaps/streamer1" {
+		t.Errorf("expected the job settings to be read, got %+v", s.Jobs[0].Settings)
+	}
+
+	cfg := config.Config{
+		Settings: config.Settings{Max: 20, OutputDir: "out"},
+		Recipes: map[string]config.Settings{
+			"shorts": {Vertical: "blur", Max: 5},
+		},
+	}
+	if err := s.Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := s.Jobs[1].ResolveSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Vertical != "blur" || settings.Max != 5 || settings.OutputDir != "out" {
+		t.Errorf("expected the recipe to be applied over the top level settings, got %+v", settings)
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	s, err := schedule.Load(filepath.Join("testdata", "schedule_invalid.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Validate(config.Config{})
+	if err == nil {
+		t.Fatal("expected an invalid schedule")
+	}
+
+	for _, want := range []string{
+		"jobs.streamer1.cron:",
+		"jobs.streamer1.name: is used by another job",
+		"jobs.streamer1.preset:",
+		"jobs.nobody.streamer: is required",
+		"jobs.nobody.recipe:",
+		"jobs.followed.followed:",
+		"jobs.list.clips:",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+}
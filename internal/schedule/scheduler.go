@@ -0,0 +1,150 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Window is the period a run compiles the clips of. Start is inclusive and
+// End is exclusive, so that consecutive windows never overlap.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Runner compiles the clips of job created within window and returns the
+// path of the compilation, or an empty path if there were no clips.
+type Runner func(ctx context.Context, job Job, window Window) (string, error)
+
+// Scheduler runs the jobs of a schedule one at a time, so that runs never
+// compete for the CPU or overlap with another run of the same job.
+type Scheduler struct {
+	jobs      []Job
+	crons     map[string]Cron
+	statePath string
+	state     State
+	run       Runner
+	// started is when jobs that have never run start waiting for their first run.
+	started time.Time
+}
+
+// New creates a scheduler for the jobs of schedule, which must be valid. The
+// progress of the jobs is read from and saved to the state file at statePath.
+func New(schedule Schedule, statePath string, run Runner) (*Scheduler, error) {
+	crons := map[string]Cron{}
+	for _, job := range schedule.Jobs {
+		cron, err := ParseCron(job.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("job %v: %w", job.Name, err)
+		}
+		crons[job.Name] = cron
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		jobs:      schedule.Jobs,
+		crons:     crons,
+		statePath: statePath,
+		state:     state,
+		run:       run,
+		started:   time.Now(),
+	}, nil
+}
+
+// Run waits for jobs to become due and runs them until ctx is canceled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next := s.Next()
+		log.Printf("next run at %v", next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if err := s.RunDue(ctx, time.Now()); err != nil {
+			return err
+		}
+	}
+}
+
+// Next returns when the next job is due. Jobs that missed runs while the
+// scheduler was not running are due immediately.
+func (s *Scheduler) Next() time.Time {
+	var next time.Time
+	for _, job := range s.jobs {
+		if due := s.nextRun(job); next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+func (s *Scheduler) nextRun(job Job) time.Time {
+	state, ok := s.state[job.Name]
+	if !ok {
+		return s.crons[job.Name].Next(s.started)
+	}
+	return s.crons[job.Name].Next(state.LastRun)
+}
+
+// RunDue runs every job that is due at now. A job that missed several runs
+// runs once, for the whole period since its last window. A failed run is
+// not retried before the next activation, whose window then also covers the
+// failed one. A run interrupted by canceling ctx is not recorded, so that it
+// is made up for once the scheduler runs again. Only failing to save the
+// state is returned as an error.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) error {
+	for _, job := range s.jobs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if s.nextRun(job).After(now) {
+			continue
+		}
+
+		cron := s.crons[job.Name]
+		end := cron.Prev(now)
+		start := s.state[job.Name].Since
+		if start.IsZero() {
+			// The first window is the period leading up to the first run.
+			start = cron.Prev(end.Add(-time.Minute))
+		}
+
+		window := Window{Start: start, End: end}
+		output, err := s.run(ctx, job, window)
+		if ctx.Err() != nil {
+			log.Printf("job %v: interrupted", job.Name)
+			return nil
+		}
+
+		state := JobState{Since: start, LastRun: now, LastOutput: output}
+		if err != nil {
+			state.LastError = err.Error()
+			log.Printf("job %v: clips from %v to %v failed: %v", job.Name, start.Format(time.DateTime), end.Format(time.DateTime), err)
+		} else {
+			state.Since = end
+			log.Printf("job %v: compiled clips from %v to %v", job.Name, start.Format(time.DateTime), end.Format(time.DateTime))
+		}
+
+		s.state[job.Name] = state
+		if err := s.state.Save(s.statePath); err != nil {
+			return fmt.Errorf("unable to save schedule state: %w", err)
+		}
+	}
+	return nil
+}
+
+// State returns the progress of every job.
+func (s *Scheduler) State() State {
+	return s.state
+}
@@ -0,0 +1,180 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/schedule"
+)
+
+type recordingRunner struct {
+	windows []schedule.Window
+	outputs []string
+	fail    bool
+}
+
+func (r *recordingRunner) run(ctx context.Context, job schedule.Job, window schedule.Window) (string, error) {
+	r.windows = append(r.windows, window)
+	r.outputs = append(r.outputs, job.DefaultOutputFile(window))
+	if r.fail {
+		return "", errors.New("compilation failed")
+	}
+	return job.Name + ".mp4", nil
+}
+
+func date(month time.Month, day, hour int) time.Time {
+	return time.Date(2024, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestRunDue(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state := schedule.State{
+		"weekly": {Since: date(1, 8, 6), LastRun: date(1, 8, 6).Add(5 * time.Second)},
+	}
+	if err := state.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	s := schedule.Schedule{Jobs: []schedule.Job{{Name: "weekly", Streamer: "streamer1", Cron: "0 6 * * 1"}}}
+	runner := &recordingRunner{}
+	scheduler, err := schedule.New(s, statePath, runner.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := scheduler.Next(); !next.Equal(date(1, 15, 6)) {
+		t.Fatalf("expected the next run on the 15th, got %v", next)
+	}
+
+	steps := []struct {
+		now        time.Time
+		fail       bool
+		wantWindow *schedule.Window
+	}{
+		// Not due yet.
+		{now: date(1, 10, 12)},
+		{now: date(1, 15, 6).Add(time.Second), wantWindow: &schedule.Window{Start: date(1, 8, 6), End: date(1, 15, 6)}},
+		// The run of the 22nd was missed, so a single run covers both weeks.
+		{now: date(1, 29, 7), wantWindow: &schedule.Window{Start: date(1, 15, 6), End: date(1, 29, 6)}},
+		{now: date(2, 5, 6), fail: true, wantWindow: &schedule.Window{Start: date(1, 29, 6), End: date(2, 5, 6)}},
+		// A failed run is not retried before the next activation.
+		{now: date(2, 5, 8)},
+		{now: date(2, 12, 6), wantWindow: &schedule.Window{Start: date(1, 29, 6), End: date(2, 12, 6)}},
+	}
+
+	for _, step := range steps {
+		runner.windows = nil
+		runner.fail = step.fail
+		if err := scheduler.RunDue(context.Background(), step.now); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case step.wantWindow == nil && len(runner.windows) != 0:
+			t.Fatalf("at %v: expected no run, got %v", step.now, runner.windows)
+		case step.wantWindow != nil && len(runner.windows) != 1:
+			t.Fatalf("at %v: expected one run, got %v", step.now, runner.windows)
+		case step.wantWindow != nil && (!runner.windows[0].Start.Equal(step.wantWindow.Start) || !runner.windows[0].End.Equal(step.wantWindow.End)):
+			t.Fatalf("at %v: expected window %v, got %v", step.now, *step.wantWindow, runner.windows[0])
+		}
+	}
+
+	// The progress survives a restart.
+	saved, err := schedule.LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved["weekly"]; !got.Since.Equal(date(2, 12, 6)) || got.LastOutput != "weekly.mp4" || got.LastError != "" {
+		t.Fatalf("unexpected saved state: %+v", got)
+	}
+}
+
+func TestRunDueFirstRun(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	s := schedule.Schedule{Jobs: []schedule.Job{{Name: "hourly", Streamer: "streamer1", Cron: "@hourly"}}}
+	runner := &recordingRunner{}
+	scheduler, err := schedule.New(s, statePath, runner.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := scheduler.Next()
+	if err := scheduler.RunDue(context.Background(), next.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.windows) != 0 {
+		t.Fatalf("expected no run before the first activation, got %v", runner.windows)
+	}
+
+	if err := scheduler.RunDue(context.Background(), next); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run covers the period leading up to it.
+	want := schedule.Window{Start: next.Add(-time.Hour), End: next}
+	if len(runner.windows) != 1 || !runner.windows[0].Start.Equal(want.Start) || !runner.windows[0].End.Equal(want.End) {
+		t.Fatalf("expected window %v, got %v", want, runner.windows)
+	}
+}
+
+func TestRunDueTwiceADay(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state := schedule.State{"twice": {Since: date(1, 14, 18)}}
+	if err := state.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	s := schedule.Schedule{Jobs: []schedule.Job{{Name: "twice", Streamer: "streamer1", Cron: "0 6,18 * * *"}}}
+	runner := &recordingRunner{}
+	scheduler, err := schedule.New(s, statePath, runner.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, now := range []time.Time{date(1, 15, 6), date(1, 15, 18)} {
+		if err := scheduler.RunDue(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both runs of the day get a compilation of their own.
+	want := []string{"twice-2024-01-15T0600.mp4", "twice-2024-01-15T1800.mp4"}
+	if !reflect.DeepEqual(want, runner.outputs) {
+		t.Fatalf("expected: %v, got: %v", want, runner.outputs)
+	}
+}
+
+func TestRunDueCanceled(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state := schedule.State{"weekly": {Since: date(1, 8, 6), LastRun: date(1, 8, 6)}}
+	if err := state.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	s := schedule.Schedule{Jobs: []schedule.Job{{Name: "weekly", Streamer: "streamer1", Cron: "0 6 * * 1"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler, err := schedule.New(s, statePath, func(ctx context.Context, job schedule.Job, window schedule.Window) (string, error) {
+		// Shutting down interrupts the run.
+		cancel()
+		return "", ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.RunDue(ctx, date(1, 15, 6)); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := schedule.LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved["weekly"]; !got.LastRun.Equal(date(1, 8, 6)) || got.LastError != "" {
+		t.Fatalf("expected the interrupted run not to be recorded, got %+v", got)
+	}
+}
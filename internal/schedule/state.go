@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State is the progress of every job, keyed by job name.
+type State map[string]JobState
+
+type JobState struct {
+	// Since is the start of the next window: the end of the last window
+	// that was compiled, or the start of a window that failed.
+	Since   time.Time `json:"since"`
+	LastRun time.Time `json:"last_run"`
+	// LastOutput is the file written by the last successful run, if it found any clips.
+	LastOutput string `json:"last_output,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// DefaultStatePath returns the location of the state file in the user
+// config directory, such as ~/.config/clipcompiler/schedule-state.json.
+func DefaultStatePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "clipcompiler", "schedule-state.json")
+}
+
+// LoadState reads the state file at path. A missing file is an empty state.
+func LoadState(path string) (State, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := State{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %v: %v", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state to path. The file is replaced atomically, so that a
+// crash while saving never loses the progress of every job.
+func (s State) Save(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, ".schedule-state-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,16 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+// SetPollIntervals shortens the polling intervals of the device code flow
+// until the test is over.
+func SetPollIntervals(t *testing.T, min, slowDown time.Duration) {
+	oldMin, oldSlowDown := minPollInterval, slowDownInterval
+	minPollInterval, slowDownInterval = min, slowDown
+	t.Cleanup(func() {
+		minPollInterval, slowDownInterval = oldMin, oldSlowDown
+	})
+}
@@ -0,0 +1,29 @@
+package twitch
+
+// ClipFilter leaves out clips that do not meet its requirements.
+// Requirements left at zero are not checked.
+type ClipFilter struct {
+	MinViews int
+	// MinDuration and MaxDuration are in seconds.
+	MinDuration float64
+	MaxDuration float64
+}
+
+// Apply returns the clips that meet the requirements, in their original order.
+func (f ClipFilter) Apply(clips []Clip) []Clip {
+	var kept []Clip
+	for _, clip := range clips {
+		if clip.ViewCount < f.MinViews {
+			continue
+		}
+		if clip.Duration < f.MinDuration {
+			continue
+		}
+		if f.MaxDuration > 0 && clip.Duration > f.MaxDuration {
+			continue
+		}
+		kept = append(kept, clip)
+	}
+
+	return kept
+}
@@ -0,0 +1,52 @@
+package twitch_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+func TestClipFilter(t *testing.T) {
+	clips := []twitch.Clip{
+		{ID: "short", ViewCount: 500, Duration: 4},
+		{ID: "unpopular", ViewCount: 3, Duration: 20},
+		{ID: "long", ViewCount: 800, Duration: 59.9},
+		{ID: "good", ViewCount: 100, Duration: 30},
+	}
+
+	testCases := map[string]struct {
+		filter twitch.ClipFilter
+		want   []string
+	}{
+		"no requirements": {
+			filter: twitch.ClipFilter{},
+			want:   []string{"short", "unpopular", "long", "good"},
+		},
+		"min views": {
+			filter: twitch.ClipFilter{MinViews: 100},
+			want:   []string{"short", "long", "good"},
+		},
+		"duration range": {
+			filter: twitch.ClipFilter{MinDuration: 5, MaxDuration: 45},
+			want:   []string{"unpopular", "good"},
+		},
+		"every requirement": {
+			filter: twitch.ClipFilter{MinViews: 10, MinDuration: 5, MaxDuration: 45},
+			want:   []string{"good"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, clip := range tc.filter.Apply(clips) {
+				got = append(got, clip.ID)
+			}
+
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
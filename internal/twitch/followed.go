@@ -0,0 +1,174 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const maxFollowedChannelsPerRequest = 100
+
+var errNoUserToken = errors.New("a user access token is required")
+
+// User is a twitch account.
+type User struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+}
+
+// FollowedChannel is a channel followed by a user.
+type FollowedChannel struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	BroadcasterName  string `json:"broadcaster_name"`
+}
+
+// GetAuthenticatedUser returns the user who authorized the service's user token.
+func (twitchSvc *twitchService) GetAuthenticatedUser() (User, error) {
+	if twitchSvc.userToken == nil {
+		return User{}, errNoUserToken
+	}
+
+	userQueryResponse := struct {
+		Data []User `json:"data"`
+	}{}
+
+	err := twitchSvc.get("users", url.Values{}, &userQueryResponse)
+	if err != nil {
+		return User{}, fmt.Errorf("unable to get user information: %w", err)
+	}
+
+	if len(userQueryResponse.Data) == 0 {
+		return User{}, errUserNotFound
+	}
+
+	return userQueryResponse.Data[0], nil
+}
+
+// GetFollowedChannels returns every channel followed by the user, which
+// must be the user who authorized the service's user token.
+func (twitchSvc *twitchService) GetFollowedChannels(userId string) ([]FollowedChannel, error) {
+	if twitchSvc.userToken == nil {
+		return nil, errNoUserToken
+	}
+
+	var channels []FollowedChannel
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Add("user_id", userId)
+		query.Add("first", strconv.Itoa(maxFollowedChannelsPerRequest))
+		if cursor != "" {
+			query.Add("after", cursor)
+		}
+
+		followedQueryRes := struct {
+			Data       []FollowedChannel `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+		}{}
+
+		err := twitchSvc.get("channels/followed", query, &followedQueryRes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get followed channels: %w", err)
+		}
+
+		channels = append(channels, followedQueryRes.Data...)
+		cursor = followedQueryRes.Pagination.Cursor
+		if cursor == "" || len(followedQueryRes.Data) == 0 {
+			return channels, nil
+		}
+	}
+}
+
+// GetFollowedClips returns the most viewed clips across every channel
+// followed by the user, at most count in total. Channels without clips in
+// the period are skipped.
+func (twitchSvc *twitchService) GetFollowedClips(userId, startDate, endDate string, count int) ([]Clip, error) {
+	start, end, err := dayRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	channelClips, err := twitchSvc.followedChannelClips(userId, start, end, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var clips []Clip
+	for _, c := range channelClips {
+		clips = append(clips, c...)
+	}
+	sortByViews(clips)
+
+	return clips[:min(count, len(clips))], nil
+}
+
+// GetFollowedDigest returns the perChannel most viewed clips of every channel
+// followed by the user, grouped by channel. Channels are ordered by their
+// most viewed clip, and channels without clips between start and end are
+// skipped.
+func (twitchSvc *twitchService) GetFollowedDigest(userId string, start, end time.Time, perChannel int) ([]Clip, error) {
+	channelClips, err := twitchSvc.followedChannelClips(userId, start, end, perChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clips := range channelClips {
+		sortByViews(clips)
+	}
+	slices.SortStableFunc(channelClips, func(a, b []Clip) int {
+		return b[0].ViewCount - a[0].ViewCount
+	})
+
+	var clips []Clip
+	for _, c := range channelClips {
+		clips = append(clips, c[:min(perChannel, len(c))]...)
+	}
+	return clips, nil
+}
+
+// followedChannelClips returns up to count clips of every channel followed by
+// the user that has clips in the period, in the order the channels are listed.
+func (twitchSvc *twitchService) followedChannelClips(userId string, start, end time.Time, count int) ([][]Clip, error) {
+	channels, err := twitchSvc.GetFollowedChannels(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(channels) == 0 {
+		return nil, errors.New("the user does not follow any channels")
+	}
+
+	var channelClips [][]Clip
+	for _, channel := range channels {
+		clips, err := twitchSvc.GetClipsBetween(channel.BroadcasterID, start, end, count)
+		if errors.Is(err, ErrNoClips) {
+			continue
+		}
+		if err != nil {
+			log.Printf("%v: skipping %v", err, channel.BroadcasterLogin)
+			continue
+		}
+		channelClips = append(channelClips, clips)
+	}
+
+	if len(channelClips) == 0 {
+		return nil, fmt.Errorf("%w from %v to %v in any followed channel",
+			ErrNoClips, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	return channelClips, nil
+}
+
+func sortByViews(clips []Clip) {
+	slices.SortStableFunc(clips, func(a, b Clip) int {
+		return b.ViewCount - a.ViewCount
+	})
+}
@@ -0,0 +1,151 @@
+package twitch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+func TestGetFollowedClips(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+
+	// Followed channels are served two pages of one channel each.
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/channels/followed":
+			if query.Get("user_id") != "1234" {
+				t.Errorf("unexpected user_id: %q", query.Get("user_id"))
+			}
+			switch query.Get("after") {
+			case "":
+				w.Write([]byte(`{"data": [{"broadcaster_id": "1", "broadcaster_login": "one"}, {"broadcaster_id": "2", "broadcaster_login": "two"}], "pagination": {"cursor": "page2"}}`))
+			case "page2":
+				w.Write([]byte(`{"data": [{"broadcaster_id": "3", "broadcaster_login": "three"}], "pagination": {}}`))
+			default:
+				t.Errorf("unexpected cursor: %q", query.Get("after"))
+			}
+		case "/clips":
+			switch id := query.Get("broadcaster_id"); id {
+			case "1":
+				w.Write([]byte(`{"data": [{"id": "a", "view_count": 10}, {"id": "b", "view_count": 5}]}`))
+			case "2":
+				w.Write([]byte(`{"data": []}`))
+			case "3":
+				w.Write([]byte(`{"data": [{"id": "c", "view_count": 20}]}`))
+			default:
+				t.Errorf("unexpected broadcaster_id: %q", id)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	token := twitch.UserToken{AccessToken: "testtoken123", ExpiresAt: time.Now().Add(time.Hour)}
+	twitchSvc, err := twitch.NewService("client_id", "", authServer.URL, apiServer.URL, twitch.WithUserToken(token, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		count int
+		want  []string
+	}{
+		"all clips by views":  {count: 10, want: []string{"c", "a", "b"}},
+		"capped to the count": {count: 2, want: []string{"c", "a"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clips, err := twitchSvc.GetFollowedClips("1234", "2023-01-01", "2023-01-07", tc.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			for _, clip := range clips {
+				ids = append(ids, clip.ID)
+			}
+			if !reflect.DeepEqual(tc.want, ids) {
+				t.Fatalf("expected: %v, got: %v", tc.want, ids)
+			}
+		})
+	}
+}
+
+func TestGetFollowedDigest(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+
+	// The last day up to the time of the run, rather than whole dates.
+	end := time.Date(2023, 1, 7, 15, 30, 0, 0, time.UTC)
+	start := end.Add(-24 * time.Hour)
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/channels/followed":
+			w.Write([]byte(`{"data": [{"broadcaster_id": "1"}, {"broadcaster_id": "2"}, {"broadcaster_id": "3"}], "pagination": {}}`))
+		case "/clips":
+			if r.URL.Query().Get("first") != "2" {
+				t.Errorf("expected 2 clips per channel to be requested, got %v", r.URL.Query().Get("first"))
+			}
+			if got := r.URL.Query().Get("started_at"); got != start.Format(time.RFC3339) {
+				t.Errorf("expected clips from %v, got %v", start.Format(time.RFC3339), got)
+			}
+			if got := r.URL.Query().Get("ended_at"); got != end.Format(time.RFC3339) {
+				t.Errorf("expected clips until %v, got %v", end.Format(time.RFC3339), got)
+			}
+			switch r.URL.Query().Get("broadcaster_id") {
+			case "1":
+				w.Write([]byte(`{"data": [{"id": "a", "broadcaster_name": "One", "view_count": 5}, {"id": "b", "broadcaster_name": "One", "view_count": 10}]}`))
+			case "2":
+				w.Write([]byte(`{"data": []}`))
+			case "3":
+				w.Write([]byte(`{"data": [{"id": "c", "broadcaster_name": "Three", "view_count": 20}]}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	token := twitch.UserToken{AccessToken: "testtoken123", ExpiresAt: time.Now().Add(time.Hour)}
+	twitchSvc, err := twitch.NewService("client_id", "", authServer.URL, apiServer.URL, twitch.WithUserToken(token, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clips, err := twitchSvc.GetFollowedDigest("1234", start, end, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, clip := range clips {
+		got = append(got, clip.BroadcasterName+"/"+clip.ID)
+	}
+	want := []string{"Three/c", "One/b", "One/a"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestGetFollowedChannelsRequiresUserToken(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+
+	twitchSvc, err := twitch.NewService("client_id", "client_secret", authServer.URL, "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := twitchSvc.GetFollowedChannels("1234"); err == nil {
+		t.Fatal("expected an error without a user token")
+	}
+}
@@ -0,0 +1,200 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ScopeUserReadFollows allows reading the channels a user follows.
+const ScopeUserReadFollows = "user:read:follows"
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Polling intervals of the device code flow, following RFC 8628 sections 3.2
+// and 3.5. The token endpoint is polled every minPollInterval unless the server asks
+// for a longer interval, which grows by slowDownInterval whenever the server
+// asks to slow down.
+var (
+	minPollInterval  = 5 * time.Second
+	slowDownInterval = 5 * time.Second
+)
+
+var (
+	// ErrDeviceCodeExpired is returned when the user did not authorize the
+	// device before its code expired.
+	ErrDeviceCodeExpired = errors.New("device code expired before it was authorized")
+	// ErrAccessDenied is returned when the user declined to authorize the device.
+	ErrAccessDenied = errors.New("authorization was denied")
+)
+
+// UserToken is a user access token, which gives access to the data of the
+// user who authorized it.
+type UserToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Scopes       []string  `json:"scopes"`
+}
+
+// Valid reports whether the token can still be used without refreshing it.
+func (t UserToken) Valid() bool {
+	return t.AccessToken != "" && time.Now().Add(appTokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+// DeviceAuthorization is a pending authorization of the device code flow.
+// The user authorizes it by entering UserCode at VerificationURI.
+type DeviceAuthorization struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	// ExpiresIn and Interval are in seconds.
+	ExpiresIn int `json:"expires_in"`
+	Interval  int `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+}
+
+func (r tokenResponse) userToken() UserToken {
+	return UserToken{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(r.ExpiresIn) * time.Second),
+		Scopes:       r.Scope,
+	}
+}
+
+// authError is the body of the responses of the auth server that are not successful.
+type authError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e authError) Error() string {
+	return fmt.Sprintf("%v %v", e.Status, e.Message)
+}
+
+// RequestDeviceAuthorization starts the device code flow for the given scopes.
+func RequestDeviceAuthorization(authBaseURL, clientId string, scopes []string) (DeviceAuthorization, error) {
+	data := url.Values{}
+	data.Set("client_id", clientId)
+	data.Set("scopes", strings.Join(scopes, " "))
+
+	var auth DeviceAuthorization
+	if err := postAuthForm(authBaseURL, "oauth2/device", data, &auth); err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("unable to start device authorization: %w", err)
+	}
+	return auth, nil
+}
+
+// PollDeviceToken waits until the user authorizes the device and returns
+// the token issued for it. clientSecret may be empty for public clients.
+func PollDeviceToken(ctx context.Context, authBaseURL, clientId, clientSecret string, auth DeviceAuthorization) (UserToken, error) {
+	data := url.Values{}
+	data.Set("client_id", clientId)
+	if clientSecret != "" {
+		data.Set("client_secret", clientSecret)
+	}
+	data.Set("device_code", auth.DeviceCode)
+	data.Set("grant_type", deviceCodeGrantType)
+
+	interval := max(time.Duration(auth.Interval)*time.Second, minPollInterval)
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for {
+		var res tokenResponse
+		err := postAuthForm(authBaseURL, "oauth2/token", data, &res)
+		if err == nil {
+			return res.userToken(), nil
+		}
+
+		var authErr authError
+		if !errors.As(err, &authErr) {
+			return UserToken{}, err
+		}
+		switch authErr.Message {
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownInterval
+		case "access_denied":
+			return UserToken{}, ErrAccessDenied
+		case "invalid device code", "expired_token":
+			return UserToken{}, ErrDeviceCodeExpired
+		default:
+			return UserToken{}, fmt.Errorf("unable to get a user access token: %w", err)
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return UserToken{}, ErrDeviceCodeExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return UserToken{}, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RefreshUserToken exchanges the refresh token of an expired user token for
+// a new token. clientSecret may be empty for public clients.
+func RefreshUserToken(authBaseURL, clientId, clientSecret string, token UserToken) (UserToken, error) {
+	data := url.Values{}
+	data.Set("client_id", clientId)
+	if clientSecret != "" {
+		data.Set("client_secret", clientSecret)
+	}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", token.RefreshToken)
+
+	var res tokenResponse
+	if err := postAuthForm(authBaseURL, "oauth2/token", data, &res); err != nil {
+		return UserToken{}, fmt.Errorf("unable to refresh user access token: %w", err)
+	}
+
+	refreshed := res.userToken()
+	if len(refreshed.Scopes) == 0 {
+		refreshed.Scopes = token.Scopes
+	}
+	return refreshed, nil
+}
+
+// postAuthForm posts data to an endpoint of the auth server and decodes the
+// response into v. Unsuccessful responses are returned as an authError.
+func postAuthForm(authBaseURL, endpoint string, data url.Values, v any) error {
+	authURL, err := url.JoinPath(authBaseURL, endpoint)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.PostForm(authURL, data)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return authError{Status: res.StatusCode, Message: "unable to read response body"}
+		}
+		authErr := authError{Status: res.StatusCode}
+		if json.Unmarshal(body, &authErr) != nil || authErr.Message == "" {
+			authErr.Message = string(body)
+		}
+		return authErr
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,275 @@
+package twitch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+// testDeviceAuthServer authorizes the device after pending polls and then
+// accepts the refresh token "refresh1".
+func testDeviceAuthServer(t *testing.T, pending int32, denied bool) (*httptest.Server, *atomic.Int32) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.Form.Get("client_id") != "client_id" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": 400, "message": "invalid client"}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/oauth2/device":
+			if r.Form.Get("scopes") != twitch.ScopeUserReadFollows {
+				t.Errorf("unexpected scopes: %q", r.Form.Get("scopes"))
+			}
+			w.Write([]byte(`{
+				"device_code": "device1",
+				"user_code": "ABCDEFGH",
+				"verification_uri": "https://www.twitch.tv/activate?device-code=ABCDEFGH",
+				"expires_in": 1800,
+				"interval": 0
+			}`))
+		case "/oauth2/token":
+			switch r.Form.Get("grant_type") {
+			case "urn:ietf:params:oauth:grant-type:device_code":
+				if r.Form.Get("device_code") != "device1" {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"status": 400, "message": "invalid device code"}`))
+					return
+				}
+				if polls.Add(1) <= pending {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"status": 400, "message": "authorization_pending"}`))
+					return
+				}
+				if denied {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"status": 400, "message": "access_denied"}`))
+					return
+				}
+				w.Write([]byte(`{
+					"access_token": "usertoken1",
+					"refresh_token": "refresh1",
+					"expires_in": 14400,
+					"scope": ["user:read:follows"],
+					"token_type": "bearer"
+				}`))
+			case "refresh_token":
+				if r.Form.Get("refresh_token") != "refresh1" {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"status": 400, "message": "Invalid refresh token"}`))
+					return
+				}
+				w.Write([]byte(`{
+					"access_token": "usertoken2",
+					"refresh_token": "refresh2",
+					"expires_in": 14400,
+					"scope": ["user:read:follows"],
+					"token_type": "bearer"
+				}`))
+			default:
+				t.Errorf("unexpected grant type: %q", r.Form.Get("grant_type"))
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server, &polls
+}
+
+func TestDeviceCodeFlow(t *testing.T) {
+	tests := map[string]struct {
+		pending   int32
+		denied    bool
+		wantToken string
+		wantErr   error
+		wantPolls int32
+	}{
+		"authorized immediately": {
+			wantToken: "usertoken1",
+			wantPolls: 1,
+		},
+		"authorized after pending polls": {
+			pending:   2,
+			wantToken: "usertoken1",
+			wantPolls: 3,
+		},
+		"denied": {
+			pending:   1,
+			denied:    true,
+			wantErr:   twitch.ErrAccessDenied,
+			wantPolls: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			twitch.SetPollIntervals(t, time.Millisecond, time.Millisecond)
+			authServer, polls := testDeviceAuthServer(t, tc.pending, tc.denied)
+			defer authServer.Close()
+
+			auth, err := twitch.RequestDeviceAuthorization(authServer.URL, "client_id", []string{twitch.ScopeUserReadFollows})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.UserCode != "ABCDEFGH" || auth.DeviceCode != "device1" {
+				t.Fatalf("unexpected device authorization: %+v", auth)
+			}
+
+			token, err := twitch.PollDeviceToken(context.Background(), authServer.URL, "client_id", "", auth)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if token.AccessToken != tc.wantToken {
+				t.Fatalf("expected token %q, got %q", tc.wantToken, token.AccessToken)
+			}
+			if tc.wantErr == nil && (token.RefreshToken != "refresh1" || !token.Valid()) {
+				t.Fatalf("expected a valid token with a refresh token, got %+v", token)
+			}
+			if got := polls.Load(); got != tc.wantPolls {
+				t.Fatalf("expected %v polls, got %v", tc.wantPolls, got)
+			}
+		})
+	}
+}
+
+func TestPollDeviceTokenIntervals(t *testing.T) {
+	const minInterval, slowDown = 20 * time.Millisecond, 40 * time.Millisecond
+	twitch.SetPollIntervals(t, minInterval, slowDown)
+
+	var mu sync.Mutex
+	var polls []time.Time
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		polls = append(polls, time.Now())
+		n := len(polls)
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": 400, "message": "authorization_pending"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": 400, "message": "slow_down"}`))
+		default:
+			w.Write([]byte(`{"access_token": "usertoken1", "refresh_token": "refresh1", "expires_in": 3600}`))
+		}
+	}))
+	defer authServer.Close()
+
+	// The server asks for no interval at all, so the minimum applies.
+	auth := twitch.DeviceAuthorization{DeviceCode: "device1", ExpiresIn: 1800, Interval: 0}
+	if _, err := twitch.PollDeviceToken(context.Background(), authServer.URL, "client_id", "", auth); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(polls) != 3 {
+		t.Fatalf("expected 3 polls, got %v", len(polls))
+	}
+	// slow_down lengthens the interval once the minimum has been waited.
+	for i, want := range []time.Duration{minInterval, minInterval + slowDown} {
+		if got := polls[i+1].Sub(polls[i]); got < want {
+			t.Fatalf("expected poll %v to wait at least %v, waited %v", i+2, want, got)
+		}
+	}
+}
+
+func TestDeviceCodeFlowInvalidClient(t *testing.T) {
+	authServer, _ := testDeviceAuthServer(t, 0, false)
+	defer authServer.Close()
+
+	if _, err := twitch.RequestDeviceAuthorization(authServer.URL, "unknown", nil); err == nil {
+		t.Fatal("expected an error for an unknown client ID")
+	}
+}
+
+func TestPollDeviceTokenCanceled(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status": 400, "message": "authorization_pending"}`))
+	}))
+	defer authServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	auth := twitch.DeviceAuthorization{DeviceCode: "device1", ExpiresIn: 1800, Interval: 5}
+	if _, err := twitch.PollDeviceToken(ctx, authServer.URL, "client_id", "", auth); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestUserTokenRefresh(t *testing.T) {
+	authServer, _ := testDeviceAuthServer(t, 0, false)
+	defer authServer.Close()
+
+	// The API only accepts the refreshed token.
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer usertoken2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "1234", "login": "viewer", "display_name": "Viewer"}]}`))
+	}))
+	defer apiServer.Close()
+
+	tests := map[string]struct {
+		token       twitch.UserToken
+		wantRefresh bool
+	}{
+		"valid token": {
+			token:       twitch.UserToken{AccessToken: "usertoken2", RefreshToken: "refresh2", ExpiresAt: time.Now().Add(time.Hour)},
+			wantRefresh: false,
+		},
+		"expired token": {
+			token:       twitch.UserToken{AccessToken: "usertoken1", RefreshToken: "refresh1", ExpiresAt: time.Now().Add(-time.Hour)},
+			wantRefresh: true,
+		},
+		"revoked token": {
+			token:       twitch.UserToken{AccessToken: "usertoken1", RefreshToken: "refresh1", ExpiresAt: time.Now().Add(time.Hour)},
+			wantRefresh: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var refreshed *twitch.UserToken
+			twitchSvc, err := twitch.NewService("client_id", "", authServer.URL, apiServer.URL,
+				twitch.WithUserToken(tc.token, func(token twitch.UserToken) { refreshed = &token }),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := twitchSvc.GetAuthenticatedUser()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != "1234" || user.Login != "viewer" {
+				t.Fatalf("unexpected user: %+v", user)
+			}
+
+			if tc.wantRefresh != (refreshed != nil) {
+				t.Fatalf("expected refresh: %v, got %+v", tc.wantRefresh, refreshed)
+			}
+			if refreshed != nil && (refreshed.AccessToken != "usertoken2" || refreshed.RefreshToken != "refresh2") {
+				t.Fatalf("unexpected refreshed token: %+v", refreshed)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quality selects which rendition of a clip is downloaded. It is either
+// QualityBest, QualityWorst or the height of the video in pixels.
+type Quality struct {
+	height int
+}
+
+var (
+	QualityBest  = Quality{height: 0}
+	QualityWorst = Quality{height: -1}
+)
+
+var errInvalidQuality = errors.New(`quality must be "best", "worst" or a video height such as 720`)
+
+// ParseQuality parses "best", "worst" or a height such as "720" or "720p".
+func ParseQuality(s string) (Quality, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "best", "":
+		return QualityBest, nil
+	case "worst":
+		return QualityWorst, nil
+	}
+
+	height, err := strconv.Atoi(strings.TrimSuffix(s, "p"))
+	if err != nil || height <= 0 {
+		return Quality{}, fmt.Errorf("%w, got %q", errInvalidQuality, s)
+	}
+	return Quality{height: height}, nil
+}
+
+func (q Quality) String() string {
+	switch q {
+	case QualityBest:
+		return "best"
+	case QualityWorst:
+		return "worst"
+	}
+	return fmt.Sprintf("%vp", q.height)
+}
+
+// selectRendition picks the rendition matching q. For a specific height, the
+// tallest rendition that does not exceed it is used, falling back to the
+// smallest one if every rendition is taller.
+func selectRendition(renditions []videoQuality, q Quality) (videoQuality, bool) {
+	if len(renditions) == 0 {
+		return videoQuality{}, false
+	}
+
+	better := func(a, b videoQuality) bool {
+		return a.height() > b.height() || (a.height() == b.height() && a.FrameRate > b.FrameRate)
+	}
+
+	best, worst := renditions[0], renditions[0]
+	var match *videoQuality
+	for i, r := range renditions {
+		if better(r, best) {
+			best = r
+		}
+		if better(worst, r) {
+			worst = r
+		}
+		if q.height > 0 && r.height() <= q.height && (match == nil || better(r, *match)) {
+			match = &renditions[i]
+		}
+	}
+
+	switch {
+	case q == QualityBest:
+		return best, true
+	case q == QualityWorst:
+		return worst, true
+	case match != nil:
+		return *match, true
+	}
+	return worst, true
+}
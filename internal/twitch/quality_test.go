@@ -0,0 +1,40 @@
+package twitch_test
+
+import (
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+func TestParseQuality(t *testing.T) {
+	type result struct {
+		quality  string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input string
+		want  result
+	}{
+		"best":            {input: "best", want: result{quality: "best"}},
+		"empty is best":   {input: "", want: result{quality: "best"}},
+		"worst":           {input: "WORST", want: result{quality: "worst"}},
+		"height":          {input: "720", want: result{quality: "720p"}},
+		"height suffix":   {input: "480p", want: result{quality: "480p"}},
+		"negative height": {input: "-720", want: result{hasError: true}},
+		"unknown":         {input: "1080p60fps", want: result{hasError: true}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			quality, err := twitch.ParseQuality(tc.input)
+			got := result{hasError: err != nil}
+			if err == nil {
+				got.quality = quality.String()
+			}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v", tc.want, got)
+			}
+		})
+	}
+}
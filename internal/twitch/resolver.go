@@ -0,0 +1,194 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/httpext"
+)
+
+// ClipSourceResolver turns a clip returned by the Helix API into a URL
+// from which the requested rendition of the clip's video can be downloaded.
+type ClipSourceResolver interface {
+	Resolve(clip Clip, quality Quality) (string, error)
+}
+
+const (
+	defaultGQLURL = "https://gql.twitch.tv/gql"
+	// Client ID used by the twitch.tv web player. The GQL API rejects
+	// client IDs issued to third party applications.
+	gqlClientID = "kimne78kx3ncx6brgo4mv6wki5h1ko"
+	// Hash of the persisted VideoAccessToken_Clip query used by the web player.
+	clipAccessTokenQueryHash = "36b89d2507fce29e5ca551df756d27c1cfe079e2609642b4390aa4c35796eb11"
+)
+
+var errResolveClip = errors.New("unable to resolve clip source")
+var errUnsupportedQuality = errors.New("quality not supported by resolver")
+
+// ThumbnailResolver derives the download URL from the clip's thumbnail URL.
+// This only works for older clips whose thumbnails are named after the video file,
+// and always points at the source rendition.
+type ThumbnailResolver struct{}
+
+func (ThumbnailResolver) Resolve(clip Clip, quality Quality) (string, error) {
+	if quality != QualityBest {
+		return "", fmt.Errorf("%w: %v", errUnsupportedQuality, quality)
+	}
+	return createDownloadURL(clip.ThumbnailURL)
+}
+
+type gqlResolver struct {
+	gqlURL string
+	client httpext.Client
+}
+
+// NewGQLResolver returns a resolver that requests a playback access token and
+// the list of available renditions from twitch's GQL API.
+func NewGQLResolver(gqlURL string) *gqlResolver {
+	return &gqlResolver{gqlURL: gqlURL, client: &http.Client{}}
+}
+
+type clipAccessToken struct {
+	PlaybackAccessToken struct {
+		Signature string `json:"signature"`
+		Value     string `json:"value"`
+	} `json:"playbackAccessToken"`
+	VideoQualities []videoQuality `json:"videoQualities"`
+}
+
+type videoQuality struct {
+	FrameRate float64 `json:"frameRate"`
+	Quality   string  `json:"quality"`
+	SourceURL string  `json:"sourceURL"`
+}
+
+func (r *gqlResolver) Resolve(clip Clip, quality Quality) (string, error) {
+	token, err := r.accessToken(clip.ID)
+	if err != nil {
+		return "", err
+	}
+
+	rendition, ok := selectRendition(token.VideoQualities, quality)
+	if !ok {
+		return "", fmt.Errorf("%w: no renditions available for %v", errResolveClip, clip.ID)
+	}
+
+	return signSourceURL(rendition.SourceURL, token.PlaybackAccessToken.Signature, token.PlaybackAccessToken.Value)
+}
+
+func (r *gqlResolver) accessToken(slug string) (*clipAccessToken, error) {
+	body := map[string]any{
+		"operationName": "VideoAccessToken_Clip",
+		"variables":     map[string]string{"slug": slug},
+		"extensions": map[string]any{
+			"persistedQuery": map[string]any{
+				"version":    1,
+				"sha256Hash": clipAccessTokenQueryHash,
+			},
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", r.gqlURL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Client-Id", gqlClientID)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(res.Body)
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		} else {
+			errMsg = string(body)
+		}
+		return nil, fmt.Errorf("%w: %v %v", errResolveClip, res.StatusCode, errMsg)
+	}
+
+	gqlRes := struct {
+		Data struct {
+			Clip *clipAccessToken `json:"clip"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+
+	err = json.NewDecoder(res.Body).Decode(&gqlRes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(gqlRes.Errors) > 0 {
+		return nil, fmt.Errorf("%w: %v", errResolveClip, gqlRes.Errors[0].Message)
+	}
+
+	if gqlRes.Data.Clip == nil {
+		return nil, fmt.Errorf("%w: %v", errClipNotFound, slug)
+	}
+
+	return gqlRes.Data.Clip, nil
+}
+
+func (q videoQuality) height() int {
+	height, err := strconv.Atoi(q.Quality)
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+func signSourceURL(sourceURL, signature, token string) (string, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errResolveClip, err)
+	}
+
+	query := u.Query()
+	query.Set("sig", signature)
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+type chainResolver []ClipSourceResolver
+
+// NewChainResolver returns a resolver that tries each of the given resolvers in
+// order and returns the first URL that could be resolved.
+func NewChainResolver(resolvers ...ClipSourceResolver) ClipSourceResolver {
+	return chainResolver(resolvers)
+}
+
+func (resolvers chainResolver) Resolve(clip Clip, quality Quality) (string, error) {
+	var errs error
+	for _, r := range resolvers {
+		downloadURL, err := r.Resolve(clip, quality)
+		if err == nil {
+			return downloadURL, nil
+		}
+		errs = errors.Join(errs, err)
+	}
+
+	if errs == nil {
+		return "", errResolveClip
+	}
+	return "", errs
+}
@@ -0,0 +1,283 @@
+package twitch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
+)
+
+const (
+	goodSlug    = "AwkwardHelplessSalamanderSwiftRage"
+	missingSlug = "MissingClip"
+)
+
+func testGQLServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	fixture := func(name string) []byte {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	clipFixture := fixture("gql_clip.json")
+	notFoundFixture := fixture("gql_clip_not_found.json")
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Client-Id") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body := struct {
+			OperationName string            `json:"operationName"`
+			Variables     map[string]string `json:"variables"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.OperationName != "VideoAccessToken_Clip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if body.Variables["slug"] == goodSlug {
+			w.Write(clipFixture)
+		} else {
+			w.Write(notFoundFixture)
+		}
+	}))
+}
+
+func TestGQLResolver(t *testing.T) {
+	server := testGQLServer(t)
+	defer server.Close()
+
+	type result struct {
+		path     string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		slug    string
+		quality twitch.Quality
+		want    result
+	}{
+		"picks the highest rendition": {
+			slug:    goodSlug,
+			quality: twitch.QualityBest,
+			want:    result{path: "/v2/media/AT-cm_1/1080.mp4"},
+		},
+		"picks the lowest rendition": {
+			slug:    goodSlug,
+			quality: twitch.QualityWorst,
+			want:    result{path: "/v2/media/AT-cm_1/360.mp4"},
+		},
+		"picks an exact height": {
+			slug:    goodSlug,
+			quality: mustParseQuality(t, "720p"),
+			want:    result{path: "/v2/media/AT-cm_1/720.mp4"},
+		},
+		"picks the closest lower height": {
+			slug:    goodSlug,
+			quality: mustParseQuality(t, "600"),
+			want:    result{path: "/v2/media/AT-cm_1/480.mp4"},
+		},
+		"falls back to the lowest height": {
+			slug:    goodSlug,
+			quality: mustParseQuality(t, "144"),
+			want:    result{path: "/v2/media/AT-cm_1/360.mp4"},
+		},
+		"clip does not exist": {
+			slug:    missingSlug,
+			quality: twitch.QualityBest,
+			want:    result{hasError: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resolver := twitch.NewGQLResolver(server.URL)
+			downloadURL, err := resolver.Resolve(twitch.Clip{ID: tc.slug}, tc.quality)
+			if tc.want.hasError != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.want.hasError, err)
+			}
+			if tc.want.hasError {
+				return
+			}
+
+			u, err := url.Parse(downloadURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Path != tc.want.path {
+				t.Fatalf("expected path: %v, got: %v", tc.want.path, u.Path)
+			}
+			if u.Query().Get("sig") != "abc123signature" {
+				t.Fatalf("expected signature in query, got: %v", u.RawQuery)
+			}
+			if u.Query().Get("token") == "" {
+				t.Fatalf("expected token in query, got: %v", u.RawQuery)
+			}
+		})
+	}
+}
+
+func mustParseQuality(t *testing.T, s string) twitch.Quality {
+	t.Helper()
+	q, err := twitch.ParseQuality(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestThumbnailResolver(t *testing.T) {
+	clip := twitch.Clip{ThumbnailURL: "https://clips-media-assets2.twitch.tv/12345-offset-20320-preview-480x272.jpg"}
+
+	downloadURL, err := twitch.ThumbnailResolver{}.Resolve(clip, twitch.QualityBest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloadURL != "https://clips-media-assets2.twitch.tv/12345-offset-20320.mp4" {
+		t.Fatalf("unexpected download URL: %v", downloadURL)
+	}
+
+	if _, err := (twitch.ThumbnailResolver{}).Resolve(clip, twitch.QualityWorst); err == nil {
+		t.Fatal("expected an error for a quality other than best")
+	}
+}
+
+type resolverFunc func(twitch.Clip, twitch.Quality) (string, error)
+
+func (f resolverFunc) Resolve(clip twitch.Clip, quality twitch.Quality) (string, error) {
+	return f(clip, quality)
+}
+
+func TestChainResolver(t *testing.T) {
+	failing := resolverFunc(func(twitch.Clip, twitch.Quality) (string, error) {
+		return "", errors.New("failed")
+	})
+	succeeding := func(result string) twitch.ClipSourceResolver {
+		return resolverFunc(func(twitch.Clip, twitch.Quality) (string, error) {
+			return result, nil
+		})
+	}
+
+	type result struct {
+		url      string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		resolvers []twitch.ClipSourceResolver
+		want      result
+	}{
+		"first resolver succeeds": {
+			resolvers: []twitch.ClipSourceResolver{succeeding("first"), succeeding("second")},
+			want:      result{url: "first"},
+		},
+		"falls back to the next resolver": {
+			resolvers: []twitch.ClipSourceResolver{failing, succeeding("second")},
+			want:      result{url: "second"},
+		},
+		"all resolvers fail": {
+			resolvers: []twitch.ClipSourceResolver{failing, failing},
+			want:      result{hasError: true},
+		},
+		"no resolvers": {
+			want: result{hasError: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			downloadURL, err := twitch.NewChainResolver(tc.resolvers...).Resolve(twitch.Clip{ID: goodSlug}, twitch.QualityBest)
+			got := result{url: downloadURL, hasError: err != nil}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGetClipURLsWithFallbackResolver(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+	gqlServer := testGQLServer(t)
+	defer gqlServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [
+			{"id": "` + goodSlug + `", "thumbnail_url": "https://static-cdn.jtvnw.net/twitch-clips-thumbnails-prod/` + goodSlug + `/abc/preview.jpg"},
+			{"id": "OldClip", "thumbnail_url": "https://clips-media-assets2.twitch.tv/12345-offset-20320-preview-480x272.jpg"},
+			{"id": "` + missingSlug + `", "thumbnail_url": "https://static-cdn.jtvnw.net/twitch-clips-thumbnails-prod/` + missingSlug + `/abc/preview.jpg"}
+		]}`))
+	}))
+	defer apiServer.Close()
+
+	resolver := twitch.NewChainResolver(twitch.ThumbnailResolver{}, twitch.NewGQLResolver(gqlServer.URL))
+	twitchSvc, err := twitch.NewService("client_id", "client_secret", authServer.URL, apiServer.URL,
+		twitch.WithClipSourceResolver(resolver),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := twitchSvc.GetClipURLs("0", "2023-10-05", "2023-10-06", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(urls) != 2 {
+		t.Fatalf("expected %v urls, got %v: %v", 2, len(urls), urls)
+	}
+
+	if u, _ := url.Parse(urls[0]); u == nil || u.Path != "/v2/media/AT-cm_1/1080.mp4" {
+		t.Fatalf("expected first clip to be resolved through GQL, got: %v", urls[0])
+	}
+
+	if urls[1] != "https://clips-media-assets2.twitch.tv/12345-offset-20320.mp4" {
+		t.Fatalf("expected second clip to be resolved through its thumbnail, got: %v", urls[1])
+	}
+}
+
+func TestGetClipURLsWithQuality(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+	gqlServer := testGQLServer(t)
+	defer gqlServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [
+			{"id": "` + goodSlug + `", "thumbnail_url": "https://clips-media-assets2.twitch.tv/12345-offset-20320-preview-480x272.jpg"}
+		]}`))
+	}))
+	defer apiServer.Close()
+
+	resolver := twitch.NewChainResolver(twitch.ThumbnailResolver{}, twitch.NewGQLResolver(gqlServer.URL))
+	twitchSvc, err := twitch.NewService("client_id", "client_secret", authServer.URL, apiServer.URL,
+		twitch.WithClipSourceResolver(resolver),
+		twitch.WithQuality(twitch.QualityWorst),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := twitchSvc.GetClipURLs("0", "2023-10-05", "2023-10-06", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(urls) != 1 {
+		t.Fatalf("expected %v urls, got %v: %v", 1, len(urls), urls)
+	}
+
+	if u, _ := url.Parse(urls[0]); u == nil || u.Path != "/v2/media/AT-cm_1/360.mp4" {
+		t.Fatalf("expected the thumbnail resolver to be skipped for a non-best quality, got: %v", urls[0])
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -21,23 +22,92 @@ type twitchService struct {
 	apiBaseURL   string
 	authBaseURL  string
 	accessToken  accessToken
+	resolver     ClipSourceResolver
+	quality      Quality
+	// userToken is used instead of an app access token when it is set.
+	userToken          *UserToken
+	onUserTokenRefresh func(UserToken)
 }
 
 type accessToken struct {
 	Value     string `json:"access_token"`
 	ExpiresIn uint   `json:"expires_in"`
 	Type      string `json:"token_type"`
+	// expiresAt is computed from ExpiresIn when the token is received.
+	expiresAt time.Time
 }
 
+// AppToken is an app access token, which can be cached and passed to
+// WithAppToken to avoid requesting a new one on every run.
+type AppToken struct {
+	Value     string    `json:"access_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// appTokenExpiryMargin keeps tokens that are about to expire from being reused.
+const appTokenExpiryMargin = time.Minute
+
+// Valid reports whether the token can still be used.
+func (t AppToken) Valid() bool {
+	return t.Value != "" && time.Now().Add(appTokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+type Clip struct {
+	ID              string    `json:"id"`
+	URL             string    `json:"url"`
+	BroadcasterID   string    `json:"broadcaster_id"`
+	BroadcasterName string    `json:"broadcaster_name"`
+	ThumbnailURL    string    `json:"thumbnail_url"`
+	Title           string    `json:"title"`
+	CreatorName     string    `json:"creator_name"`
+	ViewCount       int       `json:"view_count"`
+	Duration        float64   `json:"duration"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ClipSource is the address of a clip's video file.
+type ClipSource struct {
+	ClipID    string
+	URL       string
+	ViewCount int
+}
+
+const maxClipIDsPerRequest = 100
+
+const (
+	DefaultAuthBaseURL = "https://id.twitch.tv"
+	DefaultAPIBaseURL  = "https://api.twitch.tv/helix"
+)
+
 var errCreateDownloadURL = errors.New("unable to create download URL")
 var errUserNotFound = errors.New("user does not exist on twitch")
+var errClipNotFound = errors.New("clip does not exist on twitch")
+var errInvalidClip = errors.New("not a valid clip URL or ID")
+
+// ErrNoClips is returned when a broadcaster has no clips in the requested period.
+var ErrNoClips = errors.New("no clips found")
 
-func NewService(clientId, clientSecret, authBaseURL, apiBaseURL string) (*twitchService, error) {
+func NewService(clientId, clientSecret, authBaseURL, apiBaseURL string, options ...func(*twitchService)) (*twitchService, error) {
 	svc := &twitchService{
 		clientId:     clientId,
 		clientSecret: clientSecret,
 		apiBaseURL:   apiBaseURL,
 		authBaseURL:  authBaseURL,
+		// The thumbnail trick costs no extra request, so it is tried first.
+		resolver: NewChainResolver(ThumbnailResolver{}, NewGQLResolver(defaultGQLURL)),
+		quality:  QualityBest,
+	}
+
+	for _, opt := range options {
+		opt(svc)
+	}
+
+	if svc.userToken != nil {
+		if svc.userToken.Valid() {
+			return svc, nil
+		}
+	} else if svc.AppToken().Valid() {
+		return svc, nil
 	}
 
 	err := svc.refreshToken()
@@ -48,7 +118,59 @@ func NewService(clientId, clientSecret, authBaseURL, apiBaseURL string) (*twitch
 	return svc, nil
 }
 
+// NewServiceFromEnv creates a service with the credentials in TWITCH_CLIENT_ID
+// and TWITCH_CLIENT_SECRET. TWITCH_AUTH_BASE_URL and TWITCH_API_BASE_URL
+// replace the twitch endpoints when set.
+func NewServiceFromEnv(options ...func(*twitchService)) (*twitchService, error) {
+	authBaseURL := os.Getenv("TWITCH_AUTH_BASE_URL")
+	if authBaseURL == "" {
+		authBaseURL = DefaultAuthBaseURL
+	}
+	apiBaseURL := os.Getenv("TWITCH_API_BASE_URL")
+	if apiBaseURL == "" {
+		apiBaseURL = DefaultAPIBaseURL
+	}
+
+	return NewService(os.Getenv("TWITCH_CLIENT_ID"), os.Getenv("TWITCH_CLIENT_SECRET"), authBaseURL, apiBaseURL, options...)
+}
+
+// WithAppToken reuses a token received earlier for the same client ID.
+// A new token is requested if it has expired.
+func WithAppToken(token AppToken) func(*twitchService) {
+	return func(svc *twitchService) {
+		svc.accessToken = accessToken{Value: token.Value, Type: "bearer", expiresAt: token.ExpiresAt}
+	}
+}
+
+// WithUserToken makes requests on behalf of the user who authorized token,
+// which is needed for endpoints such as the followed channels. The token is
+// refreshed with its refresh token when it expires, and onRefresh, if not
+// nil, is called with the new token so that it can be stored.
+func WithUserToken(token UserToken, onRefresh func(UserToken)) func(*twitchService) {
+	return func(svc *twitchService) {
+		svc.userToken = &token
+		svc.onUserTokenRefresh = onRefresh
+		svc.accessToken = accessToken{Value: token.AccessToken, Type: "bearer", expiresAt: token.ExpiresAt}
+	}
+}
+
+func WithClipSourceResolver(resolver ClipSourceResolver) func(*twitchService) {
+	return func(svc *twitchService) {
+		svc.resolver = resolver
+	}
+}
+
+func WithQuality(quality Quality) func(*twitchService) {
+	return func(svc *twitchService) {
+		svc.quality = quality
+	}
+}
+
 func (twitchSvc *twitchService) refreshToken() error {
+	if twitchSvc.userToken != nil {
+		return twitchSvc.refreshUserToken()
+	}
+
 	data := url.Values{}
 	data.Set("client_id", twitchSvc.clientId)
 	data.Set("client_secret", twitchSvc.clientSecret)
@@ -76,24 +198,48 @@ func (twitchSvc *twitchService) refreshToken() error {
 		return fmt.Errorf("unable to get a new access token: %v %v", res.StatusCode, errMsg)
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&twitchSvc.accessToken)
+	var token accessToken
+	err = json.NewDecoder(res.Body).Decode(&token)
 	if err != nil {
 		return err
 	}
+	token.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	twitchSvc.accessToken = token
 
 	return nil
 }
 
+func (twitchSvc *twitchService) refreshUserToken() error {
+	token, err := RefreshUserToken(twitchSvc.authBaseURL, twitchSvc.clientId, twitchSvc.clientSecret, *twitchSvc.userToken)
+	if err != nil {
+		return err
+	}
+
+	twitchSvc.userToken = &token
+	twitchSvc.accessToken = accessToken{Value: token.AccessToken, Type: "bearer", expiresAt: token.ExpiresAt}
+	if twitchSvc.onUserTokenRefresh != nil {
+		twitchSvc.onUserTokenRefresh(token)
+	}
+
+	return nil
+}
+
+// AppToken returns the app access token currently used by the service.
+func (twitchSvc *twitchService) AppToken() AppToken {
+	return AppToken{Value: twitchSvc.accessToken.Value, ExpiresAt: twitchSvc.accessToken.expiresAt}
+}
+
 func retryIfTokenExpired(twitchSvc *twitchService) httpext.Decorator {
 	return func(c httpext.Client) httpext.Client {
 		return httpext.ClientFunc(func(req *http.Request) (*http.Response, error) {
 			res, err := c.Do(req)
-			if err != nil && res.StatusCode == http.StatusUnauthorized {
+			if err == nil && res.StatusCode == http.StatusUnauthorized {
+				res.Body.Close()
 				err = twitchSvc.refreshToken()
 				if err != nil {
 					return nil, err
 				}
-				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", twitchSvc.accessToken.Value))
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", twitchSvc.accessToken.Value))
 				return c.Do(req)
 			}
 			return res, err
@@ -103,108 +249,177 @@ func retryIfTokenExpired(twitchSvc *twitchService) httpext.Decorator {
 }
 
 func (twitchSvc *twitchService) GetClipURLs(broadcasterId, startDate, endDate string, count int) ([]string, error) {
-	start, err := time.Parse("2006-01-02", startDate)
+	clips, err := twitchSvc.GetClips(broadcasterId, startDate, endDate, count)
 	if err != nil {
 		return nil, err
 	}
 
-	end, err := time.Parse("2006-01-02", endDate)
+	return twitchSvc.downloadURLs(clips), nil
+}
+
+func (twitchSvc *twitchService) GetClips(broadcasterId, startDate, endDate string, count int) ([]Clip, error) {
+	start, end, err := dayRange(startDate, endDate)
 	if err != nil {
 		return nil, err
 	}
-	end = end.Add(time.Hour*time.Duration(23) +
-		time.Minute*time.Duration(59) +
-		time.Second*time.Duration(59))
 
-	apiURL, err := url.JoinPath(twitchSvc.apiBaseURL, "clips")
+	clips, err := twitchSvc.getClips(broadcasterId, start, end, count)
 	if err != nil {
 		return nil, err
 	}
-	client := httpext.Decorate(&http.Client{}, retryIfTokenExpired(twitchSvc))
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	if len(clips) == 0 {
+		return nil, fmt.Errorf("%w from %v to %v", ErrNoClips, startDate, endDate)
+	}
+
+	return clips, nil
+}
+
+// GetClipsBetween returns the most viewed clips of the broadcaster created
+// between start and end, inclusive.
+func (twitchSvc *twitchService) GetClipsBetween(broadcasterId string, start, end time.Time, count int) ([]Clip, error) {
+	clips, err := twitchSvc.getClips(broadcasterId, start, end, count)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", twitchSvc.accessToken.Value))
-	req.Header.Add("Client-Id", twitchSvc.clientId)
+	if len(clips) == 0 {
+		return nil, fmt.Errorf("%w from %v to %v", ErrNoClips, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	return clips, nil
+}
+
+// dayRange returns the period from the start of startDate to the end of
+// endDate, which are dates in UTC.
+func dayRange(startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end = end.Add(time.Hour*time.Duration(23) +
+		time.Minute*time.Duration(59) +
+		time.Second*time.Duration(59))
 
-	query := req.URL.Query()
+	return start, end, nil
+}
+
+func (twitchSvc *twitchService) getClips(broadcasterId string, start, end time.Time, count int) ([]Clip, error) {
+	query := url.Values{}
 	query.Add("broadcaster_id", broadcasterId)
 	query.Add("started_at", start.Format(time.RFC3339))
 	query.Add("ended_at", end.Format(time.RFC3339))
 	query.Add("first", strconv.Itoa(count))
-	req.URL.RawQuery = query.Encode()
 
-	res, err := client.Do(req)
+	clipQueryRes := struct {
+		Data []Clip `json:"data"`
+	}{}
+
+	err := twitchSvc.get("clips", query, &clipQueryRes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clips: %w", err)
+	}
+
+	return clipQueryRes.Data, nil
+}
+
+func (twitchSvc *twitchService) GetClipURLsByID(ids []string) ([]string, error) {
+	clips, err := twitchSvc.GetClipsByID(ids)
 	if err != nil {
 		return nil, err
 	}
 
-	defer res.Body.Close()
+	return twitchSvc.downloadURLs(clips), nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(res.Body)
-		var errMsg string
+// GetClipsByID looks up clips by their IDs and returns them in the same order as ids.
+// Clips that no longer exist on twitch are skipped.
+func (twitchSvc *twitchService) GetClipsByID(ids []string) ([]Clip, error) {
+	found := map[string]Clip{}
+	for i := 0; i < len(ids); i += maxClipIDsPerRequest {
+		batch := ids[i:min(i+maxClipIDsPerRequest, len(ids))]
+		query := url.Values{}
+		for _, id := range batch {
+			query.Add("id", id)
+		}
+
+		clipQueryRes := struct {
+			Data []Clip `json:"data"`
+		}{}
+
+		err := twitchSvc.get("clips", query, &clipQueryRes)
 		if err != nil {
-			errMsg = err.Error()
-		} else {
-			errMsg = string(body)
+			return nil, fmt.Errorf("unable to get clips: %w", err)
+		}
+
+		for _, clip := range clipQueryRes.Data {
+			found[clip.ID] = clip
 		}
-		return nil, fmt.Errorf("unable to get clips: %v %v", res.StatusCode, errMsg)
 	}
 
-	clipQueryRes := struct {
+	var clips []Clip
+	for _, id := range ids {
+		clip, ok := found[id]
+		if !ok {
+			log.Printf("%v: skipping %v", errClipNotFound, id)
+			continue
+		}
+		clips = append(clips, clip)
+	}
+
+	if len(clips) == 0 {
+		return nil, errors.New("none of the requested clips were found")
+	}
+
+	return clips, nil
+}
+
+func (twitchSvc *twitchService) GetBroadcasterID(username string) (string, error) {
+	query := url.Values{}
+	query.Add("login", username)
+
+	userQueryResponse := struct {
 		Data []struct {
-			ThumbnailURL string `json:"thumbnail_url"`
+			ID string `json:"id"`
 		} `json:"data"`
 	}{}
 
-	err = json.NewDecoder(res.Body).Decode(&clipQueryRes)
+	err := twitchSvc.get("users", query, &userQueryResponse)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("unable to get user information: %w", err)
 	}
 
-	if len(clipQueryRes.Data) == 0 {
-		return nil, fmt.Errorf("no clips found from %v to %v", startDate, endDate)
-	}
-
-	var downloadURLs []string
-	for _, clip := range clipQueryRes.Data {
-		downloadURL, err := createDownloadURL(clip.ThumbnailURL)
-		if !errors.Is(err, errCreateDownloadURL) {
-			downloadURLs = append(downloadURLs, downloadURL)
-		} else {
-			log.Printf("%v: skipping %v", err, clip.ThumbnailURL)
-		}
+	if len(userQueryResponse.Data) == 0 {
+		return "", errUserNotFound
 	}
 
-	return downloadURLs, nil
+	return userQueryResponse.Data[0].ID, nil
 }
 
-func (twitchSvc *twitchService) GetBroadcasterID(username string) (string, error) {
-	apiURL, err := url.JoinPath(twitchSvc.apiBaseURL, "users")
+func (twitchSvc *twitchService) get(endpoint string, query url.Values, v any) error {
+	apiURL, err := url.JoinPath(twitchSvc.apiBaseURL, endpoint)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	client := httpext.Decorate(&http.Client{}, retryIfTokenExpired(twitchSvc))
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
-		return "nil", err
+		return err
 	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", twitchSvc.accessToken.Value))
 	req.Header.Add("Client-Id", twitchSvc.clientId)
-
-	query := req.URL.Query()
-	query.Add("login", username)
 	req.URL.RawQuery = query.Encode()
 
 	res, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	defer res.Body.Close()
@@ -216,25 +431,70 @@ func (twitchSvc *twitchService) GetBroadcasterID(username string) (string, error
 		} else {
 			errMsg = string(body)
 		}
-		return "", fmt.Errorf("unable to get user information: %v %v", res.StatusCode, errMsg)
+		return fmt.Errorf("%v %v", res.StatusCode, errMsg)
 	}
 
-	userQueryResponse := struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
-	}{}
+	return json.NewDecoder(res.Body).Decode(v)
+}
 
-	err = json.NewDecoder(res.Body).Decode(&userQueryResponse)
+func (twitchSvc *twitchService) downloadURLs(clips []Clip) []string {
+	var urls []string
+	for _, source := range twitchSvc.ClipSources(clips) {
+		urls = append(urls, source.URL)
+	}
+
+	return urls
+}
+
+// ClipSources resolves the video file of every clip at the service's quality.
+// Clips that cannot be resolved are logged and skipped.
+func (twitchSvc *twitchService) ClipSources(clips []Clip) []ClipSource {
+	var sources []ClipSource
+	for _, clip := range clips {
+		downloadURL, err := twitchSvc.resolver.Resolve(clip, twitchSvc.quality)
+		if err != nil {
+			log.Printf("%v: skipping %v", err, clip.ID)
+			continue
+		}
+		sources = append(sources, ClipSource{ClipID: clip.ID, URL: downloadURL, ViewCount: clip.ViewCount})
+	}
+
+	return sources
+}
+
+// ParseClipID extracts the clip ID (slug) from a clip URL such as
+// https://clips.twitch.tv/Slug or https://www.twitch.tv/user/clip/Slug.
+// Anything that does not look like a URL is treated as an ID.
+func ParseClipID(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errInvalidClip
+	}
+
+	if !strings.Contains(s, "/") {
+		return s, nil
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", errInvalidClip, err)
 	}
 
-	if len(userQueryResponse.Data) == 0 {
-		return "", errUserNotFound
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	switch {
+	case host == "clips.twitch.tv" && len(segments) == 1 && segments[0] != "":
+		return segments[0], nil
+	case host == "twitch.tv" && len(segments) == 3 && segments[1] == "clip" && segments[2] != "":
+		return segments[2], nil
 	}
 
-	return userQueryResponse.Data[0].ID, nil
+	return "", fmt.Errorf("%w: %v", errInvalidClip, s)
 }
 
 func createDownloadURL(thumbnailURL string) (string, error) {
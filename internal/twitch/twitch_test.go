@@ -2,10 +2,13 @@ package twitch_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jaaanko/twitch-clip-compilation-tool/internal/twitch"
 )
@@ -218,3 +221,181 @@ func testAuthServer() *httptest.Server {
 		}`))
 	}))
 }
+
+func TestGetClipURLsByID(t *testing.T) {
+	authServer := testAuthServer()
+	defer authServer.Close()
+
+	type clip struct {
+		ID           string `json:"id"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+
+	var requestedBatches [][]string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := r.URL.Query()["id"]
+		requestedBatches = append(requestedBatches, ids)
+
+		// Return clips in reverse order and drop the missing one to make sure
+		// the service reorders and skips on its own.
+		var data []clip
+		for i := len(ids) - 1; i >= 0; i-- {
+			if ids[i] == "missing" {
+				continue
+			}
+			data = append(data, clip{
+				ID:           ids[i],
+				ThumbnailURL: fmt.Sprintf("https://clips-media-assets2.twitch.tv/%v-preview-480x272.jpg", ids[i]),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string][]clip{"data": data})
+	}))
+	defer apiServer.Close()
+
+	var ids []string
+	var want []string
+	for i := 0; i < 150; i++ {
+		id := fmt.Sprintf("clip%v", i)
+		ids = append(ids, id)
+		want = append(want, fmt.Sprintf("https://clips-media-assets2.twitch.tv/%v.mp4", id))
+	}
+	ids = append(ids[:10], append([]string{"missing"}, ids[10:]...)...)
+
+	twitchSvc, err := twitch.NewService("client_id", "client_secret", authServer.URL, apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := twitchSvc.GetClipURLsByID(ids)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if len(requestedBatches) != 2 || len(requestedBatches[0]) != 100 || len(requestedBatches[1]) != 51 {
+		t.Fatalf("expected batches of 100 and 51 ids, got %v batches", len(requestedBatches))
+	}
+
+	if !reflect.DeepEqual(want, urls) {
+		t.Fatalf("expected: %v, got: %v", want, urls)
+	}
+}
+
+func TestParseClipID(t *testing.T) {
+	type result struct {
+		id       string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input string
+		want  result
+	}{
+		"plain id": {
+			input: "AwkwardHelplessSalamanderSwiftRage",
+			want:  result{id: "AwkwardHelplessSalamanderSwiftRage"},
+		},
+		"clips subdomain": {
+			input: "https://clips.twitch.tv/AwkwardHelplessSalamanderSwiftRage",
+			want:  result{id: "AwkwardHelplessSalamanderSwiftRage"},
+		},
+		"clips subdomain without scheme": {
+			input: "clips.twitch.tv/AwkwardHelplessSalamanderSwiftRage",
+			want:  result{id: "AwkwardHelplessSalamanderSwiftRage"},
+		},
+		"channel clip url with query": {
+			input: "https://www.twitch.tv/streamer1/clip/AwkwardHelplessSalamanderSwiftRage?filter=clips",
+			want:  result{id: "AwkwardHelplessSalamanderSwiftRage"},
+		},
+		"channel url without clip": {
+			input: "https://www.twitch.tv/streamer1",
+			want:  result{hasError: true},
+		},
+		"other host": {
+			input: "https://example.com/clip/AwkwardHelplessSalamanderSwiftRage",
+			want:  result{hasError: true},
+		},
+		"empty": {
+			input: "  ",
+			want:  result{hasError: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			id, err := twitch.ParseClipID(tc.input)
+			got := result{id: id, hasError: err != nil}
+			if got != tc.want {
+				t.Fatalf("expected: %#v, got: %#v, error: %v", tc.want, got, err)
+			}
+		})
+	}
+}
+
+func TestAppToken(t *testing.T) {
+	var tokenRequests atomic.Int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		w.Write([]byte(`{"access_token": "freshtoken", "expires_in": 3600, "token_type": "bearer"}`))
+	}))
+	defer authServer.Close()
+
+	// The API only accepts the fresh token, like twitch does once a token is revoked.
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer freshtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "1234"}]}`))
+	}))
+	defer apiServer.Close()
+
+	tests := map[string]struct {
+		token             twitch.AppToken
+		wantTokenRequests int32
+	}{
+		"no cached token": {
+			token:             twitch.AppToken{},
+			wantTokenRequests: 1,
+		},
+		"valid cached token": {
+			token:             twitch.AppToken{Value: "freshtoken", ExpiresAt: time.Now().Add(time.Hour)},
+			wantTokenRequests: 0,
+		},
+		"expired cached token": {
+			token:             twitch.AppToken{Value: "freshtoken", ExpiresAt: time.Now().Add(-time.Hour)},
+			wantTokenRequests: 1,
+		},
+		"revoked cached token": {
+			token:             twitch.AppToken{Value: "revokedtoken", ExpiresAt: time.Now().Add(time.Hour)},
+			wantTokenRequests: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenRequests.Store(0)
+			twitchSvc, err := twitch.NewService("client_id", "client_secret", authServer.URL, apiServer.URL,
+				twitch.WithAppToken(tc.token),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := twitchSvc.GetBroadcasterID("test1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != "1234" {
+				t.Fatalf("expected: 1234, got: %v", id)
+			}
+
+			if got := tokenRequests.Load(); got != tc.wantTokenRequests {
+				t.Fatalf("expected %v token requests, got %v", tc.wantTokenRequests, got)
+			}
+
+			if token := twitchSvc.AppToken(); token.Value != "freshtoken" || !token.Valid() {
+				t.Fatalf("expected the service to hold a valid fresh token, got %+v", token)
+			}
+		})
+	}
+}
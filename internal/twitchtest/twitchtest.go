@@ -0,0 +1,50 @@
+// Package twitchtest stubs the twitch auth and API servers for tests.
+package twitchtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serve starts a fake twitch server for the duration of the test and points
+// the twitch environment variables at it. User streamer1 has ID 1234 and two
+// clips, a and b, whose video files are found from their thumbnails and are
+// both served from sample. Any other user or broadcaster has nothing.
+func Serve(t *testing.T, sample string) {
+	t.Helper()
+
+	var twitchServer *httptest.Server
+	twitchServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			w.Write([]byte(`{"access_token": "testtoken123", "expires_in": 5513382, "token_type": "bearer"}`))
+		case "/helix/users":
+			if r.URL.Query().Get("login") != "streamer1" {
+				w.Write([]byte(`{"data": []}`))
+				return
+			}
+			w.Write([]byte(`{"data": [{"id": "1234", "login": "streamer1"}]}`))
+		case "/helix/clips":
+			if r.URL.Query().Get("broadcaster_id") != "1234" {
+				w.Write([]byte(`{"data": []}`))
+				return
+			}
+			fmt.Fprintf(w, `{"data": [
+				{"id": "a", "thumbnail_url": "%[1]v/clips/a-preview-480x272.jpg"},
+				{"id": "b", "thumbnail_url": "%[1]v/clips/b-preview-480x272.jpg"}
+			]}`, twitchServer.URL)
+		case "/clips/a.mp4", "/clips/b.mp4":
+			http.ServeFile(w, r, sample)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(twitchServer.Close)
+
+	t.Setenv("TWITCH_CLIENT_ID", "client_id")
+	t.Setenv("TWITCH_CLIENT_SECRET", "client_secret")
+	t.Setenv("TWITCH_AUTH_BASE_URL", twitchServer.URL)
+	t.Setenv("TWITCH_API_BASE_URL", twitchServer.URL+"/helix")
+}